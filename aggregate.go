@@ -0,0 +1,255 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupCount is the number of documents sharing a value
+type GroupCount struct {
+	Key   interface{} `bson:"_id"`
+	Count int         `bson:"value"`
+}
+
+// GroupValue is a value computed over the documents sharing a value
+type GroupValue struct {
+	Key   interface{} `bson:"_id"`
+	Value float64     `bson:"value"`
+}
+
+// GroupCount counts the documents matching query per value of field, most
+// frequent first. Documents without field are counted with a nil Key
+func (db *DB) GroupCount(coll, field string, query interface{}) ([]GroupCount, error) {
+	var groups = []GroupCount{}
+
+	if err := db.groupBy(coll, field, bson.M{"$sum": 1}, query, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// SumBy sums the numeric sumField of the documents matching query per value
+// of groupField, largest first
+func (db *DB) SumBy(coll, groupField, sumField string, query interface{}) ([]GroupValue, error) {
+	return db.groupValues(coll, groupField, "$sum", sumField, query)
+}
+
+// AvgBy is SumBy with the average of avgField
+func (db *DB) AvgBy(coll, groupField, avgField string, query interface{}) ([]GroupValue, error) {
+	return db.groupValues(coll, groupField, "$avg", avgField, query)
+}
+
+// MinBy is SumBy with the minimum of minField
+func (db *DB) MinBy(coll, groupField, minField string, query interface{}) ([]GroupValue, error) {
+	return db.groupValues(coll, groupField, "$min", minField, query)
+}
+
+// MaxBy is SumBy with the maximum of maxField
+func (db *DB) MaxBy(coll, groupField, maxField string, query interface{}) ([]GroupValue, error) {
+	return db.groupValues(coll, groupField, "$max", maxField, query)
+}
+
+func (db *DB) groupValues(coll, groupField, accumulator, field string,
+	query interface{}) ([]GroupValue, error) {
+	var groups = []GroupValue{}
+
+	if err := db.groupBy(coll, groupField, bson.M{accumulator: fieldPath(field)}, query, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// groupBy decodes the groups of the documents matching query by field with
+// the accumulator as value into v, largest value first
+func (db *DB) groupBy(coll, field string, accumulator bson.M, query interface{},
+	v interface{}) error {
+	var pipeline, err = Pipeline().
+		Match(query).
+		Group(fieldPath(field), bson.M{"value": accumulator}).
+		Sort("-value", "_id").
+		Build()
+	if err != nil {
+		return err
+	}
+
+	return db.Pipe(coll, pipeline, v)
+}
+
+// dateUnits are the $dateTrunc units TimeSeries uses, largest first
+var dateUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+	{"millisecond", time.Millisecond},
+}
+
+// TimeSeries rolls up the documents matching query per interval of their
+// timeField, e.g. per 5 minutes, and decodes a document per interval into v
+// in chronological order. The start of the interval in UTC is the field
+// "time", aggregations are computed like $group fields, e.g.
+// M{"avg": M{"$avg": "$rssi"}, "n": M{"$sum": 1}}. Requires MongoDB 5.0
+func (db *DB) TimeSeries(coll, timeField string, interval time.Duration,
+	aggregations bson.M, query interface{}, v interface{}) error {
+	var trunc, err = dateTrunc(fieldPath(timeField), interval)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var projection = bson.M{"_id": 0, "time": "$_id"}
+	for field := range aggregations {
+		projection[field] = 1
+	}
+
+	pipeline, err := Pipeline().
+		Match(query).
+		Group(trunc, aggregations).
+		Sort("_id").
+		Project(projection).
+		Build()
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return db.Pipe(coll, pipeline, v)
+}
+
+// dateTrunc truncates the date at path to the interval
+func dateTrunc(path string, interval time.Duration) (bson.M, error) {
+	for _, unit := range dateUnits {
+		if interval > 0 && interval%unit.d == 0 {
+			return bson.M{"$dateTrunc": bson.M{
+				"date":    path,
+				"unit":    unit.name,
+				"binSize": int64(interval / unit.d),
+			}}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: interval %v is no multiple of a millisecond", ErrInvalidQuery, interval)
+}
+
+// Bucket is the number of documents with a value in [Min, Max)
+type Bucket struct {
+	Min   float64
+	Max   float64
+	Count int
+}
+
+// Histogram counts the documents matching query per range of the numeric
+// field, e.g. boundaries -90, -80, -70 for two RSSI ranges. Documents with a
+// value outside of the boundaries are left out, every range is returned
+// even if it is empty
+func (db *DB) Histogram(coll, field string, boundaries []float64,
+	query interface{}) ([]Bucket, error) {
+	if len(boundaries) < 2 {
+		return nil, fmt.Errorf("%s: %w: less than 2 boundaries", coll, ErrInvalidQuery)
+	}
+
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i] <= boundaries[i-1] {
+			return nil, fmt.Errorf("%s: %w: boundaries %v not ascending", coll, ErrInvalidQuery, boundaries)
+		}
+	}
+
+	var inRange = bson.M{field: bson.M{"$gte": boundaries[0], "$lt": boundaries[len(boundaries)-1]}}
+
+	var pipeline, err = Pipeline().
+		Match(bson.M{"$and": bson.A{filter(query), inRange}}).
+		Stage("$bucket", bson.M{"groupBy": fieldPath(field), "boundaries": boundaries}).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var counts []struct {
+		Min   float64 `bson:"_id"`
+		Count int     `bson:"count"`
+	}
+
+	if err = db.Pipe(coll, pipeline, &counts); err != nil {
+		return nil, err
+	}
+
+	var buckets = make([]Bucket, len(boundaries)-1)
+	for i := range buckets {
+		buckets[i] = Bucket{Min: boundaries[i], Max: boundaries[i+1]}
+	}
+
+	for _, c := range counts {
+		var i = sort.SearchFloat64s(boundaries, c.Min)
+		if i < len(buckets) {
+			buckets[i].Count = c.Count
+		}
+	}
+
+	return buckets, nil
+}
+
+// HistogramAuto counts the documents matching query in n ranges of the
+// numeric field chosen to hold about the same number of documents each
+func (db *DB) HistogramAuto(coll, field string, n int, query interface{}) ([]Bucket, error) {
+	var pipeline, err = Pipeline().
+		Match(query).
+		Stage("$bucketAuto", bson.M{"groupBy": fieldPath(field), "buckets": n}).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var results []struct {
+		Range struct {
+			Min float64 `bson:"min"`
+			Max float64 `bson:"max"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+
+	if err = db.Pipe(coll, pipeline, &results); err != nil {
+		return nil, err
+	}
+
+	var buckets = make([]Bucket, len(results))
+	for i, r := range results {
+		buckets[i] = Bucket{Min: r.Range.Min, Max: r.Range.Max, Count: r.Count}
+	}
+
+	return buckets, nil
+}
+
+// CountDistinct returns the number of distinct values of field among the
+// documents matching query without fetching them. Like with Distinct the
+// elements of arrays count individually, missing and null values don't
+func (db *DB) CountDistinct(coll, field string, query interface{}) (int, error) {
+	var pipeline, err = Pipeline().
+		Match(query).
+		Unwind(field).
+		Group(fieldPath(field), nil).
+		Count("n").
+		Build()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var result struct {
+		N int `bson:"n"`
+	}
+
+	err = db.pipeOne(coll, pipeline, options.Aggregate(), &result)
+	if errors.Is(err, ErrNotFound) {
+		// $count outputs nothing without documents
+		return 0, nil
+	}
+
+	return result.N, err
+}
@@ -0,0 +1,91 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PushOptions for PushToArray, zero values are left unset
+type PushOptions struct {
+	// Position inserts the values at this index instead of appending them,
+	// negative counts from the end
+	Position *int
+
+	// Slice trims the array after the push to its first Slice elements,
+	// or its last ones if negative
+	Slice int
+
+	// Sort orders the array after the push, 1 or -1 for plain values or
+	// fields of the elements, e.g. M{"score": -1}
+	Sort interface{}
+}
+
+func (o *PushOptions) each(values []interface{}) bson.D {
+	var spec = bson.D{{Key: "$each", Value: values}}
+	if o == nil {
+		return spec
+	}
+
+	if o.Position != nil {
+		spec = append(spec, bson.E{Key: "$position", Value: *o.Position})
+	}
+
+	if o.Slice != 0 {
+		spec = append(spec, bson.E{Key: "$slice", Value: o.Slice})
+	}
+
+	if o.Sort != nil {
+		spec = append(spec, bson.E{Key: "$sort", Value: o.Sort})
+	}
+
+	return spec
+}
+
+// PushToArray appends values to the array field of the first document
+// matching query, opts may be nil
+func (db *DB) PushToArray(coll string, query interface{}, field string, opts *PushOptions,
+	values ...interface{}) (*ChangeInfo, error) {
+	if values == nil {
+		values = []interface{}{}
+	}
+
+	return db.updateArray(coll, query, "$push", field, opts.each(values), false)
+}
+
+// AddToSet adds those of values to the array field of the first document
+// matching query that it doesn't contain yet
+func (db *DB) AddToSet(coll string, query interface{}, field string, values ...interface{}) (*ChangeInfo, error) {
+	if values == nil {
+		values = []interface{}{}
+	}
+
+	return db.updateArray(coll, query, "$addToSet", field, bson.D{{Key: "$each", Value: values}}, true)
+}
+
+// PullFromArray removes the elements equal to condition from the array
+// field of the first document matching query, or those matching it if it
+// is a query, e.g. M{"$lt": 5} or M{"band": "2.4"}
+func (db *DB) PullFromArray(coll string, query interface{}, field string, condition interface{}) (*ChangeInfo, error) {
+	return db.updateArray(coll, query, "$pull", field, condition, true)
+}
+
+func (db *DB) updateArray(coll string, query interface{}, op, field string, spec interface{},
+	retryable bool) (*ChangeInfo, error) {
+	if !validField(field) {
+		return nil, fmt.Errorf("%s: %w: %q is not a field", coll, ErrInvalidQuery, field)
+	}
+
+	var (
+		update = bson.M{op: bson.M{field: spec}}
+		o      = &Op{Name: "update", Collection: coll, Query: query}
+	)
+
+	return db.update(o, true, retryable, func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateOne(ctx, filter(query), update,
+			&options.UpdateOptions{Comment: commentValue(ctx)})
+	})
+}
@@ -0,0 +1,166 @@
+package mongo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// writeOps are the operations reported to audit hooks and throttled by
+// write limits
+var writeOps = map[string]bool{
+	"insert":            true,
+	"update":            true,
+	"replace":           true,
+	"upsert":            true,
+	"remove":            true,
+	"bulkWrite":         true,
+	"pipeTo":            true,
+	"findOneAndUpdate":  true,
+	"findOneAndDelete":  true,
+	"findOneAndReplace": true,
+}
+
+// AuditEvent describes a successful write
+type AuditEvent struct {
+	// Actor as passed to WithActor, empty if there is none
+	Actor string
+
+	Operation  string
+	Collection string
+
+	// Query selecting the written documents, nil for inserts
+	Query interface{}
+
+	// IDs of the written documents as far as known, see Op
+	IDs []interface{}
+
+	// N is the number of documents affected
+	N int
+}
+
+type actorKey struct{}
+
+// WithActor attaches the actor, e.g. a user name, to ctx for audit hooks.
+// Writes of db.WithContext(ctx) are attributed to it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// WithAuditHook calls fn after every successful write to build an audit
+// trail, synchronously so fn should be quick. Writes of a transaction are
+// reported before it commits
+func WithAuditHook(fn func(AuditEvent)) Option {
+	return func(db *DB) {
+		var h = db.callbacks()
+
+		h.onAudit = append(h.onAudit, fn)
+	}
+}
+
+func (h *hooks) audit(ctx context.Context, o *Op) {
+	if h == nil || !writeOps[o.Name] {
+		return
+	}
+
+	h.Lock()
+	var fns = h.onAudit
+	h.Unlock()
+
+	if len(fns) == 0 {
+		return
+	}
+
+	var actor, _ = ctx.Value(actorKey{}).(string)
+
+	var e = AuditEvent{
+		Actor:      actor,
+		Operation:  o.Name,
+		Collection: o.Collection,
+		Query:      o.Query,
+		IDs:        o.IDs,
+		N:          o.N,
+	}
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// queryIDs returns the ids query selects by _id, either a single value, an
+// $eq or an $in list, nil for other queries. query may be a map, a bson.D or
+// a *Query
+func queryIDs(query interface{}) []interface{} {
+	var id, ok = lookup(query, "_id")
+	if !ok || id == nil {
+		return nil
+	}
+
+	if !operators(id) {
+		return []interface{}{id}
+	}
+
+	if eq, ok := lookup(id, "$eq"); ok {
+		return []interface{}{eq}
+	}
+
+	var in, _ = lookup(id, "$in")
+
+	var list = reflect.ValueOf(in)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil
+	}
+
+	var ids = make([]interface{}, list.Len())
+	for i := range ids {
+		ids[i] = list.Index(i).Interface()
+	}
+
+	return ids
+}
+
+// lookup returns the value of key in doc, which may be a map, a bson.D or a
+// *Query
+func lookup(doc interface{}, key string) (interface{}, bool) {
+	switch d := doc.(type) {
+	case bson.M:
+		var v, ok = d[key]
+		return v, ok
+	case map[string]interface{}:
+		var v, ok = d[key]
+		return v, ok
+	case bson.D:
+		for _, e := range d {
+			if e.Key == key {
+				return e.Value, true
+			}
+		}
+	case *Query:
+		if d != nil {
+			return lookup(d.M(), key)
+		}
+	}
+
+	return nil, false
+}
+
+// operators reports whether v is a document of query operators like
+// {"$in": [...]} rather than a value to compare with
+func operators(v interface{}) bool {
+	switch d := v.(type) {
+	case bson.M:
+		for k := range d {
+			return strings.HasPrefix(k, "$")
+		}
+	case map[string]interface{}:
+		for k := range d {
+			return strings.HasPrefix(k, "$")
+		}
+	case bson.D:
+		return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+package mongo
+
+import (
+	"crypto/tls"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Authentication mechanisms for Credential.AuthMechanism
+const (
+	AuthSCRAMSHA1   = "SCRAM-SHA-1"
+	AuthSCRAMSHA256 = "SCRAM-SHA-256"
+	AuthX509        = "MONGODB-X509"
+)
+
+// Credential configures authentication explicitly instead of through the DSN
+type Credential = options.Credential
+
+// WithCredential authenticates with cred, it overrides credentials in the DSN
+func WithCredential(cred Credential) Option {
+	return WithClientOptions(options.Client().SetAuth(cred))
+}
+
+// WithSCRAMSHA256 authenticates user against the source database, "admin"
+// if empty, with the SCRAM-SHA-256 mechanism
+func WithSCRAMSHA256(user, password, source string) Option {
+	return WithCredential(Credential{
+		AuthMechanism: AuthSCRAMSHA256,
+		AuthSource:    source,
+		Username:      user,
+		Password:      password,
+	})
+}
+
+// WithX509 authenticates with the client certificate of cfg, which also
+// becomes the TLS config of the connection, see LoadTLSConfig. The user is
+// derived from the certificate subject by the server
+func WithX509(cfg *tls.Config) Option {
+	var credential = WithCredential(Credential{
+		AuthMechanism: AuthX509,
+		AuthSource:    "$external",
+	})
+
+	var transport = WithTLS(cfg)
+
+	return func(db *DB) {
+		transport(db)
+		credential(db)
+	}
+}
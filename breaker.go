@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// breaker fails operations fast while the deployment keeps failing, so that
+// callers don't pile up waiting for timeouts
+type breaker struct {
+	sync.Mutex
+
+	threshold int
+	coolDown  time.Duration
+
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// WithCircuitBreaker fails operations with ErrCircuitOpen for coolDown once
+// failures operations in a row failed with a transient error or a timeout.
+// Afterwards a single operation probes the deployment, the circuit closes
+// if it succeeds and stays open for another coolDown if it fails. It is
+// shared by all handles of the connection
+func WithCircuitBreaker(failures int, coolDown time.Duration) Option {
+	if failures < 1 {
+		failures = 1
+	}
+
+	return func(db *DB) {
+		db.breaker = &breaker{threshold: failures, coolDown: coolDown}
+	}
+}
+
+// allow reports whether an operation may run and whether it is the probe
+// of an open circuit, the caller must pass both its outcome and probe to
+// done
+func (b *breaker) allow() (ok, probe bool) {
+	if b == nil {
+		return true, false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return true, false
+	case b.probing || time.Now().Before(b.openUntil):
+		return false, false
+	}
+
+	b.probing = true
+
+	return true, true
+}
+
+// errAborted is the outcome of an operation that panicked, it says nothing
+// about the deployment
+var errAborted = errors.New("operation aborted")
+
+// done records the outcome of an operation. Only the probe closes or
+// reopens the circuit, operations that started before it opened don't
+func (b *breaker) done(probe bool, err error, log Logger) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+
+	var failed = IsTransient(err) || mongo.IsTimeout(err)
+
+	switch {
+	case err == errAborted:
+	case probe && !failed:
+		b.failures = 0
+
+		log.Warnf("mongo: circuit closed")
+	case probe:
+		b.openUntil = time.Now().Add(b.coolDown)
+
+		log.Warnf("mongo: circuit open for %v: %v", b.coolDown, err)
+	case b.failures >= b.threshold:
+		// open already, the probe decides
+	case !failed:
+		b.failures = 0
+	case b.failures+1 == b.threshold:
+		b.failures = b.threshold
+		b.openUntil = time.Now().Add(b.coolDown)
+
+		log.Warnf("mongo: circuit open for %v: %v", b.coolDown, err)
+	default:
+		b.failures++
+	}
+}
@@ -0,0 +1,334 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+type bulkKind int
+
+const (
+	bulkInsert bulkKind = iota
+	bulkUpdate
+	bulkUpdateAll
+	bulkUpsert
+	bulkRemove
+	bulkRemoveAll
+)
+
+// BulkOp is a single operation of BulkWrite
+type BulkOp struct {
+	kind  bulkKind
+	query interface{}
+	doc   interface{}
+}
+
+// BulkInsert inserts doc
+func BulkInsert(doc interface{}) BulkOp {
+	return BulkOp{kind: bulkInsert, doc: doc}
+}
+
+// BulkUpdate updates the first document matching query, like
+// UpdateWithQuery a document without operators replaces it
+func BulkUpdate(query, update interface{}) BulkOp {
+	return BulkOp{kind: bulkUpdate, query: query, doc: update}
+}
+
+// BulkUpdateAll updates all documents matching query
+func BulkUpdateAll(query, update interface{}) BulkOp {
+	return BulkOp{kind: bulkUpdateAll, query: query, doc: update}
+}
+
+// BulkUpsert updates the first document matching query or inserts it
+func BulkUpsert(query, update interface{}) BulkOp {
+	return BulkOp{kind: bulkUpsert, query: query, doc: update}
+}
+
+// BulkRemove removes the first document matching query
+func BulkRemove(query interface{}) BulkOp {
+	return BulkOp{kind: bulkRemove, query: query}
+}
+
+// BulkRemoveAll removes all documents matching query
+func BulkRemoveAll(query interface{}) BulkOp {
+	return BulkOp{kind: bulkRemoveAll, query: query}
+}
+
+// model returns the write model of op and the ids of the documents it
+// writes as far as known
+func (op BulkOp) model() (mongo.WriteModel, []interface{}, error) {
+	switch op.kind {
+	case bulkInsert:
+		var doc, id, err = withID(op.doc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return mongo.NewInsertOneModel().SetDocument(doc), []interface{}{id}, nil
+	case bulkUpdateAll:
+		return mongo.NewUpdateManyModel().SetFilter(filter(op.query)).SetUpdate(op.doc), queryIDs(op.query), nil
+	case bulkRemove:
+		return mongo.NewDeleteOneModel().SetFilter(filter(op.query)), queryIDs(op.query), nil
+	case bulkRemoveAll:
+		return mongo.NewDeleteManyModel().SetFilter(filter(op.query)), queryIDs(op.query), nil
+	}
+
+	var isUpdate, err = hasOperators(op.doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var upsert = op.kind == bulkUpsert
+
+	if isUpdate {
+		return mongo.NewUpdateOneModel().SetFilter(filter(op.query)).
+			SetUpdate(op.doc).SetUpsert(upsert), queryIDs(op.query), nil
+	}
+
+	return mongo.NewReplaceOneModel().SetFilter(filter(op.query)).
+		SetReplacement(op.doc).SetUpsert(upsert), queryIDs(op.query), nil
+}
+
+// withID returns doc marshalled with an _id, a new ObjectID as the driver
+// would add if it has none, so that the id is known before the insert
+func withID(doc interface{}) (bson.Raw, interface{}, error) {
+	var raw, err = bson.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if v, err := bson.Raw(raw).LookupErr("_id"); err == nil {
+		var id interface{}
+		if err = v.Unmarshal(&id); err != nil {
+			return nil, nil, err
+		}
+
+		return raw, id, nil
+	}
+
+	var id = primitive.NewObjectID()
+
+	return bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendObjectIDElement(nil, "_id", id), raw[4:len(raw)-1]), id, nil
+}
+
+// BulkResult of BulkWrite, on partial failure it holds the counts of the
+// operations that succeeded
+type BulkResult struct {
+	Inserted int
+	Matched  int
+	Modified int
+	Upserted int
+	Removed  int
+
+	// Status of each operation by its index in the ops passed to BulkWrite
+	Status []BulkStatus
+
+	// InsertedIDs maps the index of an applied insert to the _id of the
+	// document, generated if it had none
+	InsertedIDs map[int]interface{}
+
+	// UpsertedIDs maps the index of an upsert operation to the new _id
+	UpsertedIDs map[int]interface{}
+
+	// Errors of the failed operations, an ordered write stops at the first
+	Errors []BulkError
+}
+
+// BulkStatus is the outcome of a single operation of BulkWrite
+type BulkStatus int
+
+const (
+	// BulkUnknown operations may or may not have been applied, e.g. when
+	// the connection failed during the write
+	BulkUnknown BulkStatus = iota
+	BulkApplied
+	BulkFailed
+
+	// BulkSkipped operations weren't attempted since an earlier one of an
+	// ordered write failed
+	BulkSkipped
+)
+
+// BulkError is the failure of a single operation of BulkWrite
+type BulkError struct {
+	// Index of the operation in the ops passed to BulkWrite
+	Index   int
+	Code    int
+	Message string
+}
+
+func (e BulkError) Error() string {
+	return e.Message
+}
+
+// BulkWrite runs ops in a single batch. An ordered batch stops at the first
+// failing operation, an unordered one attempts all of them. The error
+// describes the failures, details are in BulkResult.Status and Errors
+func (db *DB) BulkWrite(coll string, ops []BulkOp, ordered bool) (*BulkResult, error) {
+	if len(ops) == 0 {
+		return nil, ErrInvalidQuery
+	}
+
+	var (
+		models = make([]mongo.WriteModel, len(ops))
+		ids    = make([][]interface{}, len(ops))
+	)
+
+	for i, op := range ops {
+		var m, opIDs, err = op.model()
+		if err != nil {
+			return nil, err
+		}
+
+		models[i], ids[i] = m, opIDs
+	}
+
+	var (
+		result = newBulkResult(len(ops))
+		o      = &Op{Name: "bulkWrite", Collection: coll}
+	)
+
+	var err = db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(ordered).SetComment(commentValue(ctx)))
+
+		result.fill(res, err, ordered)
+
+		o.N = result.Inserted + result.Modified + result.Upserted + result.Removed
+		o.IDs = result.applied(ops, ids)
+
+		return err
+	})
+
+	return result, err
+}
+
+func newBulkResult(n int) *BulkResult {
+	return &BulkResult{
+		Status:      make([]BulkStatus, n),
+		InsertedIDs: map[int]interface{}{},
+		UpsertedIDs: map[int]interface{}{},
+	}
+}
+
+// fill takes the counts, failures and status of each operation of a
+// BulkWrite into r, res is nil if nothing was written
+func (r *BulkResult) fill(res *mongo.BulkWriteResult, err error, ordered bool) {
+	var bwe mongo.BulkWriteException
+
+	switch {
+	case err == nil:
+		r.mark(0, len(r.Status), BulkApplied)
+	case errors.As(err, &bwe):
+		var (
+			failures = append([]mongo.BulkWriteError{}, bwe.WriteErrors...)
+			next     = 0
+		)
+
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+
+		for _, we := range failures {
+			r.Errors = append(r.Errors, BulkError{Index: we.Index, Code: we.Code, Message: we.Message})
+
+			r.mark(next, we.Index, BulkApplied)
+			r.mark(we.Index, we.Index+1, BulkFailed)
+			next = we.Index + 1
+		}
+
+		if ordered && len(failures) > 0 {
+			r.mark(next, len(r.Status), BulkSkipped)
+		} else {
+			r.mark(next, len(r.Status), BulkApplied)
+		}
+	}
+
+	if res == nil {
+		return
+	}
+
+	r.Inserted = int(res.InsertedCount)
+	r.Matched = int(res.MatchedCount)
+	r.Modified = int(res.ModifiedCount)
+	r.Upserted = int(res.UpsertedCount)
+	r.Removed = int(res.DeletedCount)
+
+	for i, id := range res.UpsertedIDs {
+		r.UpsertedIDs[int(i)] = id
+	}
+}
+
+// mark sets the status of the operations from to before to
+func (r *BulkResult) mark(from, to int, status BulkStatus) {
+	for i := from; i < to && i < len(r.Status); i++ {
+		r.Status[i] = status
+	}
+}
+
+// applied records the ids of the applied inserts of ops and returns the ids
+// written by all applied ops as far as known, ids holds those of each op
+func (r *BulkResult) applied(ops []BulkOp, ids [][]interface{}) []interface{} {
+	var written []interface{}
+
+	for i, op := range ops {
+		if r.Status[i] != BulkApplied {
+			continue
+		}
+
+		if op.kind == bulkInsert {
+			r.InsertedIDs[i] = ids[i][0]
+		}
+
+		written = append(written, ids[i]...)
+
+		// upserts by _id are known already
+		if id, ok := r.UpsertedIDs[i]; ok && len(ids[i]) == 0 {
+			written = append(written, id)
+		}
+	}
+
+	return written
+}
+
+// limits of a single insert command, the size leaves room for the command
+// around the documents
+const (
+	maxBatchDocs  = 1000
+	maxBatchBytes = 16*1024*1024 - 16*1024
+)
+
+// splitBatches splits docs into batches within the limits, a document
+// exceeding the size limit gets a batch of its own for the server to reject
+func splitBatches(docs []interface{}) ([][]interface{}, error) {
+	var (
+		batches [][]interface{}
+		start   int
+		size    int
+	)
+
+	for i, doc := range docs {
+		var raw, err = bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > start && (i-start == maxBatchDocs || size+len(raw) > maxBatchBytes) {
+			batches = append(batches, docs[start:i])
+			start, size = i, 0
+		}
+
+		size += len(raw)
+	}
+
+	if start < len(docs) {
+		batches = append(batches, docs[start:])
+	}
+
+	return batches, nil
+}
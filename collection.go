@@ -0,0 +1,116 @@
+package mongo
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Collection is a typed handle for a collection whose documents decode into T
+type Collection[T any] struct {
+	db   *DB
+	name string
+}
+
+// NewCollection returns a typed handle for the collection name of db.
+// Go doesn't allow type parameters on methods, hence no db.Collection[T]
+func NewCollection[T any](db *DB, name string) *Collection[T] {
+	return &Collection[T]{db: db, name: name}
+}
+
+// Name returns the name of the collection
+func (c *Collection[T]) Name() string { return c.name }
+
+func (c *Collection[T]) FindOne(query interface{}) (T, error) {
+	var v T
+
+	var err = c.db.FindWithQueryOne(c.name, query, &v)
+
+	return v, err
+}
+
+func (c *Collection[T]) FindByID(id interface{}) (T, error) {
+	return c.FindOne(M{"_id": id})
+}
+
+func (c *Collection[T]) FindAll(query interface{}) ([]T, error) {
+	var v = []T{}
+
+	var err = c.db.FindWithQueryAll(c.name, query, &v)
+
+	return v, err
+}
+
+// Page is a page of results as returned by an API, from FindPage or
+// FindAfter
+type Page[T any] struct {
+	Items []T `json:"items"`
+
+	// Total is the number of all matching documents, FindAfter leaves it
+	// zero
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+
+	// NextToken continues FindAfter with the next page, empty on the last
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+// FindPage returns the page of documents matching query after skipping
+// offset with their total, see DB.FindPage
+func (c *Collection[T]) FindPage(query interface{}, sort string, limit, offset int) (Page[T], error) {
+	var page = Page[T]{Items: []T{}, Limit: limit, Offset: offset}
+
+	var total, err = c.db.FindPage(c.name, query, sort, limit, offset, &page.Items)
+
+	page.Total = total
+
+	return page, err
+}
+
+// FindAfter returns the page of documents matching query after the one
+// token was made from, see DB.FindAfter
+func (c *Collection[T]) FindAfter(query interface{}, sort string, limit int, token string) (Page[T], error) {
+	var page = Page[T]{Items: []T{}, Limit: limit}
+
+	var next, err = c.db.FindAfter(c.name, query, sort, limit, token, &page.Items)
+
+	page.NextToken = next
+
+	return page, err
+}
+
+// FindChan sends the documents matching query over the returned channel,
+// see DB.FindChan. A document that doesn't decode into T ends the query
+// with an error
+func (c *Collection[T]) FindChan(query interface{}) (<-chan T, func() error) {
+	return stream(c.db, c.name, query, func(raw bson.Raw) (T, error) {
+		var v T
+
+		var err = bson.Unmarshal(raw, &v)
+
+		return v, err
+	})
+}
+
+func (c *Collection[T]) Count(query interface{}) (int, error) {
+	return c.db.Count(c.name, query)
+}
+
+func (c *Collection[T]) Insert(docs ...T) error {
+	var v = make([]interface{}, len(docs))
+
+	for i := range docs {
+		v[i] = docs[i]
+	}
+
+	return c.db.Insert(c.name, v...)
+}
+
+func (c *Collection[T]) Update(id interface{}, v T) (*ChangeInfo, error) {
+	return c.db.Update(c.name, id, v)
+}
+
+func (c *Collection[T]) Upsert(id interface{}, v T) (*ChangeInfo, error) {
+	return c.db.Upsert(c.name, id, v)
+}
+
+func (c *Collection[T]) Remove(id interface{}) (int, error) {
+	return c.db.Remove(c.name, id)
+}
@@ -0,0 +1,92 @@
+package mongo
+
+import (
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// collScans remembers which query shapes scan their collection, shared by
+// all handles of a connection
+type collScans struct {
+	fail bool
+	seen sync.Map
+}
+
+// WithCollScanCheck explains every distinct query shape of find, count,
+// distinct and aggregate operations once and logs those that scan the whole
+// collection. With fail set such queries return ErrCollScan instead of
+// running, e.g. to catch missing indexes in integration tests. Queries
+// without a filter are expected to scan and pass. Meant for development, the
+// first query of every shape takes an extra round trip
+func WithCollScanCheck(fail bool) Option {
+	return func(db *DB) {
+		db.collScans = &collScans{fail: fail}
+	}
+}
+
+func (db *DB) checkCollScan(o *Op) error {
+	var cmd bson.D
+
+	switch o.Name {
+	case "find", "findOne", "count", "distinct":
+		cmd = findCommand(o.Collection, o.Query, nil)
+	case "aggregate":
+		cmd = pipeCommand(o.Collection, o.Query, nil)
+	}
+
+	var s = db.collScans
+	if s == nil || cmd == nil {
+		return nil
+	}
+
+	var query = shape(o.Query)
+	if query == "{}" || o.Name == "aggregate" && !filtered(o.Query) {
+		return nil
+	}
+
+	var key = o.Collection + " " + query
+
+	scan, checked := s.seen.Load(key)
+	if !checked {
+		var e, err = db.explain(&Op{Name: "explain", Collection: o.Collection, Query: o.Query},
+			cmd, "queryPlanner")
+		if err != nil {
+			db.logger().Debugf("mongo: explain %s %s: %v", o.Collection, query, err)
+			return nil
+		}
+
+		scan, _ = s.seen.LoadOrStore(key, e.CollScan)
+
+		if e.CollScan {
+			db.logger().Warnf("mongo: %s %s scans the whole collection", o.Collection, query)
+		}
+	}
+
+	if scan.(bool) && s.fail {
+		return fmt.Errorf("%s: %w: %s", o.Collection, ErrCollScan, query)
+	}
+
+	return nil
+}
+
+// filtered reports whether pipeline starts with a $match that has a filter,
+// otherwise it is expected to read the whole collection
+func filtered(pipeline interface{}) bool {
+	var list, err = stages(pipeline)
+	if err != nil || len(list) == 0 {
+		return false
+	}
+
+	var stage, _ = bson.Marshal(list[0])
+
+	var match, ok = bson.Raw(stage).Lookup("$match").DocumentOK()
+	if !ok {
+		return false
+	}
+
+	var elems, _ = match.Elements()
+
+	return len(elems) > 0
+}
@@ -0,0 +1,37 @@
+package mongo
+
+import "context"
+
+type commentKey struct{}
+
+// WithComment attaches comment to ctx, operations of db.WithContext(ctx)
+// send it as $comment. It shows up in currentOp, the profiler and the
+// server log, e.g. to trace a slow query back to its request ID
+func WithComment(ctx context.Context, comment string) context.Context {
+	return context.WithValue(ctx, commentKey{}, comment)
+}
+
+// Comment returns a handle whose operations send comment as $comment, see
+// WithComment
+func (db *DB) Comment(comment string) *DB {
+	return db.WithContext(WithComment(db.parent(), comment))
+}
+
+// comment returns the comment of ctx for options taking a *string, nil if
+// there is none
+func comment(ctx context.Context) *string {
+	if c, ok := ctx.Value(commentKey{}).(string); ok {
+		return &c
+	}
+
+	return nil
+}
+
+// commentValue is comment for options taking an interface{}
+func commentValue(ctx context.Context) interface{} {
+	if c := comment(ctx); c != nil {
+		return *c
+	}
+
+	return nil
+}
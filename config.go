@@ -0,0 +1,251 @@
+package mongo
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+const defaultEnvPrefix = "MONGO_"
+
+// Config describes a connection in structured form, the credentials never
+// become part of the DSN
+type Config struct {
+	// Hosts as host:port, or the single SRV record name if SRV is set
+	Hosts []string
+	SRV   bool
+
+	Database   string
+	ReplicaSet string
+
+	User       string
+	Password   string
+	AuthSource string
+
+	// Timeout of the connection, see WithTimeout
+	Timeout time.Duration
+
+	// MaxTime of queries, see WithMaxTimeMS
+	MaxTime time.Duration
+
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// ConfigFromEnv reads a Config from environment variables named with prefix,
+// "MONGO_" if empty: HOSTS (comma separated), SRV, DATABASE, REPLICA_SET,
+// USER, PASSWORD, AUTH_SOURCE, TIMEOUT and MAX_TIME (Go durations), TLS,
+// TLS_CA_FILE, TLS_CERT_FILE and TLS_KEY_FILE. The result is validated
+func ConfigFromEnv(prefix string) (*Config, error) {
+	if prefix == "" {
+		prefix = defaultEnvPrefix
+	}
+
+	var (
+		err error
+		cfg = &Config{
+			Database:    os.Getenv(prefix + "DATABASE"),
+			ReplicaSet:  os.Getenv(prefix + "REPLICA_SET"),
+			User:        os.Getenv(prefix + "USER"),
+			Password:    os.Getenv(prefix + "PASSWORD"),
+			AuthSource:  os.Getenv(prefix + "AUTH_SOURCE"),
+			TLSCAFile:   os.Getenv(prefix + "TLS_CA_FILE"),
+			TLSCertFile: os.Getenv(prefix + "TLS_CERT_FILE"),
+			TLSKeyFile:  os.Getenv(prefix + "TLS_KEY_FILE"),
+		}
+	)
+
+	for _, host := range strings.Split(os.Getenv(prefix+"HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			cfg.Hosts = append(cfg.Hosts, host)
+		}
+	}
+
+	if cfg.SRV, err = envBool(prefix + "SRV"); err != nil {
+		return nil, err
+	}
+
+	if cfg.TLS, err = envBool(prefix + "TLS"); err != nil {
+		return nil, err
+	}
+
+	if cfg.Timeout, err = envDuration(prefix + "TIMEOUT"); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxTime, err = envDuration(prefix + "MAX_TIME"); err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func envBool(name string) (bool, error) {
+	var v = os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+
+	var b, err = strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
+	}
+
+	return b, nil
+}
+
+func envDuration(name string) (time.Duration, error) {
+	var v = os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	var d, err = time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
+	}
+
+	return d, nil
+}
+
+// ConfigFromDSN parses a connection string into a Config
+func ConfigFromDSN(dsn string) (*Config, error) {
+	var cs, err = connstring.ParseAndValidate(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, redactError(err, dsn))
+	}
+
+	var cfg = &Config{
+		Hosts:       cs.Hosts,
+		SRV:         cs.Scheme == connstring.SchemeMongoDBSRV,
+		Database:    cs.Database,
+		ReplicaSet:  cs.ReplicaSet,
+		User:        cs.Username,
+		Password:    cs.Password,
+		AuthSource:  cs.AuthSource,
+		Timeout:     cs.ConnectTimeout,
+		TLS:         cs.SSL,
+		TLSCAFile:   cs.SSLCaFile,
+		TLSCertFile: cs.SSLCertificateFile,
+		TLSKeyFile:  cs.SSLPrivateKeyFile,
+	}
+
+	if cfg.SRV {
+		cfg.Hosts = cs.RawHosts
+	}
+
+	if cs.SSLClientCertificateKeyFile != "" {
+		cfg.TLSCertFile = cs.SSLClientCertificateKeyFile
+		cfg.TLSKeyFile = cs.SSLClientCertificateKeyFile
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate reports the first inconsistency of the config
+func (c *Config) Validate() error {
+	switch {
+	case len(c.Hosts) == 0:
+		return fmt.Errorf("%w: no hosts", ErrInvalidConfig)
+	case c.SRV && len(c.Hosts) != 1:
+		return fmt.Errorf("%w: SRV needs exactly one host", ErrInvalidConfig)
+	case c.Password != "" && c.User == "":
+		return fmt.Errorf("%w: password without user", ErrInvalidConfig)
+	case (c.TLSCertFile == "") != (c.TLSKeyFile == ""):
+		return fmt.Errorf("%w: TLS certificate and key go together", ErrInvalidConfig)
+	case !c.TLS && (c.TLSCAFile != "" || c.TLSCertFile != ""):
+		return fmt.Errorf("%w: TLS files without TLS", ErrInvalidConfig)
+	case c.Timeout < 0 || c.MaxTime < 0:
+		return fmt.Errorf("%w: negative timeout", ErrInvalidConfig)
+	}
+
+	for _, host := range c.Hosts {
+		if host == "" || strings.ContainsAny(host, "/?@,") {
+			return fmt.Errorf("%w: invalid host %q", ErrInvalidConfig, host)
+		}
+	}
+
+	return nil
+}
+
+// DSN returns the connection string of the config without credentials
+func (c *Config) DSN() string {
+	var (
+		scheme = connstring.SchemeMongoDB
+		query  = url.Values{}
+	)
+
+	if c.SRV {
+		scheme = connstring.SchemeMongoDBSRV
+	}
+
+	if c.ReplicaSet != "" {
+		query.Set("replicaSet", c.ReplicaSet)
+	}
+
+	var dsn = scheme + "://" + strings.Join(c.Hosts, ",") + "/" + c.Database
+	if len(query) > 0 {
+		dsn += "?" + query.Encode()
+	}
+
+	return dsn
+}
+
+// Options returns the connection options for the config, the TLS files are
+// loaded here
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+
+	if c.Database != "" {
+		opts = append(opts, WithDatabase(c.Database))
+	}
+
+	if c.Timeout > 0 {
+		opts = append(opts, WithTimeout(c.Timeout))
+	}
+
+	if c.MaxTime > 0 {
+		opts = append(opts, WithMaxTimeMS(c.MaxTime))
+	}
+
+	if c.User != "" {
+		opts = append(opts, WithCredential(Credential{
+			AuthSource: c.AuthSource,
+			Username:   c.User,
+			Password:   c.Password,
+		}))
+	}
+
+	if c.TLS {
+		var tlsConfig, err = LoadTLSConfig(c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithTLS(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+// NewConnectionFromConfig validates cfg and connects with it, opts are
+// applied after the ones derived from cfg
+func NewConnectionFromConfig(cfg *Config, opts ...Option) (*DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var cfgOpts, err = cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConnection(cfg.DSN(), append(cfgOpts, opts...)...)
+}
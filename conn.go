@@ -0,0 +1,100 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// conn is a client with its own monitor. It counts the operations using it
+// so that it can be replaced while they run
+type conn struct {
+	client   *mongo.Client
+	dsn      string
+	database string
+	appName  string
+	monitor  *monitor
+	pool     *poolStats
+	users    sync.WaitGroup
+}
+
+// close disconnects the client right away
+func (c *conn) close() {
+	c.monitor.close()
+	_ = c.client.Disconnect(context.Background())
+}
+
+// closeIdle disconnects the client once the operations using it finished
+func (c *conn) closeIdle() {
+	c.users.Wait()
+	c.close()
+}
+
+// link points to the conn in use, it is shared by a DB and its handles so
+// that all of them follow when it is replaced
+type link struct {
+	sync.RWMutex
+
+	conn *conn
+}
+
+// current returns the conn in use, nil if not connected
+func (l *link) current() *conn {
+	if l == nil {
+		return nil
+	}
+
+	l.RLock()
+	defer l.RUnlock()
+
+	return l.conn
+}
+
+// acquire is current for the duration of an operation, the caller must
+// call users.Done on the result when finished
+func (l *link) acquire() *conn {
+	if l == nil {
+		return nil
+	}
+
+	l.RLock()
+	defer l.RUnlock()
+
+	if l.conn != nil {
+		l.conn.users.Add(1)
+	}
+
+	return l.conn
+}
+
+// swap puts c in use and returns the previous conn
+func (l *link) swap(c *conn) *conn {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	var old = l.conn
+
+	l.conn = c
+
+	return old
+}
+
+// replace puts c in use only if old still is, so that a concurrent
+// Disconnect or reconnect is not undone
+func (l *link) replace(old, c *conn) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.conn != old {
+		return false
+	}
+
+	l.conn = c
+
+	return true
+}
@@ -0,0 +1,114 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CurrentOp is an operation in progress on the server
+type CurrentOp struct {
+	// OpID identifies the operation for KillOp, a number on mongod and a
+	// "shard:number" string on mongos
+	OpID interface{} `bson:"opid"`
+
+	Active      bool   `bson:"active"`
+	Op          string `bson:"op"`
+	Namespace   string `bson:"ns"`
+	Secs        int64  `bson:"secs_running"`
+	Microsecs   int64  `bson:"microsecs_running"`
+	Client      string `bson:"client"`
+	AppName     string `bson:"appName"`
+	Desc        string `bson:"desc"`
+	PlanSummary string `bson:"planSummary"`
+	Command     bson.M `bson:"command"`
+}
+
+// ListCurrentOps returns the operations in progress of all users that match
+// query, e.g. M{"secs_running": M{"$gt": 60}}. query may be nil
+func (db *DB) ListCurrentOps(query interface{}) ([]CurrentOp, error) {
+	var (
+		ops      = []CurrentOp{}
+		o        = &Op{Name: "currentOp", Query: query, Result: &ops}
+		pipeline = []bson.M{
+			{"$currentOp": bson.M{"allUsers": true}},
+			{"$match": filter(query)},
+		}
+	)
+
+	var err = db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Database().Client().Database("admin").Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+
+		if err = cur.All(ctx, &ops); err != nil {
+			return err
+		}
+
+		o.N = len(ops)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// KillOp terminates the operation with the OpID of a CurrentOp
+func (db *DB) KillOp(id interface{}) error {
+	var res bson.M
+
+	return db.adminCommand("killOp", bson.D{{Key: "killOp", Value: 1}, {Key: "op", Value: id}}, &res)
+}
+
+// ReapOps kills operations of this application running for longer than
+// maxAge every interval, e.g. admin commands that ignore maxTimeMS. They are
+// recognized by the application name, see WithAppName, so operations of
+// other instances using the same name are reaped as well. It runs until the
+// returned stop is called or db is disconnected, an interval that isn't
+// positive reaps every 10s
+func (db *DB) ReapOps(maxAge, interval time.Duration) (stop func()) {
+	return db.poll("reaper", interval, func() error {
+		return db.reap(maxAge)
+	})
+}
+
+func (db *DB) reap(maxAge time.Duration) error {
+	var c = db.link.current()
+	if c == nil {
+		return ErrNotConnected
+	}
+
+	if c.appName == "" {
+		return errors.New("no application name to recognize operations by, see WithAppName")
+	}
+
+	var ops, err = db.ListCurrentOps(bson.M{
+		"active":            true,
+		"appName":           c.appName,
+		"microsecs_running": bson.M{"$gte": maxAge.Microseconds()},
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, op := range ops {
+		if err = db.KillOp(op.OpID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		db.logger().Warnf("mongo: killed %s %s of %s running for %v",
+			op.Op, op.Namespace, op.Client, time.Duration(op.Microsecs)*time.Microsecond)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package mongo
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrNotConnected is returned by operations on a DB without a connection
+	ErrNotConnected = errors.New("DB is not connected")
+
+	// ErrInvalidQuery is returned when the arguments can't form a valid query
+	ErrInvalidQuery = errors.New("Query is not valid")
+
+	// ErrInvalidConfig is returned for inconsistent connection settings
+	ErrInvalidConfig = errors.New("Config is not valid")
+
+	// ErrCollScan is returned by queries scanning the whole collection when
+	// WithCollScanCheck fails them
+	ErrCollScan = errors.New("Query scans the whole collection")
+
+	// ErrCircuitOpen is returned without contacting the deployment while it
+	// is considered down, see WithCircuitBreaker
+	ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+	// ErrNotFound is returned when a query matched no document, it is the
+	// driver's mongo.ErrNoDocuments so both work with errors.Is
+	ErrNotFound = mongo.ErrNoDocuments
+)
@@ -0,0 +1,202 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Explain is the query plan the server chose for a query or pipeline and
+// the statistics of running it
+type Explain struct {
+	// Plan is the winning plan from its root stage down, nil if the
+	// pipeline doesn't start with a query
+	Plan *PlanStage
+
+	// Indexes used by the plan, empty when it scans the collection
+	Indexes []string
+
+	// CollScan is set if the plan reads the whole collection
+	CollScan bool
+
+	Returned     int
+	KeysExamined int
+	DocsExamined int
+	Duration     time.Duration
+
+	// Raw is the complete output of the explain command
+	Raw bson.Raw
+}
+
+// PlanStage is a stage of a query plan, e.g. FETCH, IXSCAN or COLLSCAN
+type PlanStage struct {
+	Stage       string       `bson:"stage"`
+	IndexName   string       `bson:"indexName,omitempty"`
+	InputStage  *PlanStage   `bson:"inputStage,omitempty"`
+	InputStages []*PlanStage `bson:"inputStages,omitempty"`
+
+	// QueryPlan holds the stages when the server uses the slot based
+	// engine, walk accounts for it
+	QueryPlan *PlanStage `bson:"queryPlan,omitempty"`
+}
+
+// walk calls fn for s and all of its input stages
+func (s *PlanStage) walk(fn func(*PlanStage)) {
+	if s == nil {
+		return
+	}
+
+	fn(s)
+
+	s.QueryPlan.walk(fn)
+	s.InputStage.walk(fn)
+
+	for _, in := range s.InputStages {
+		in.walk(fn)
+	}
+}
+
+type explainOutput struct {
+	QueryPlanner *struct {
+		WinningPlan *PlanStage `bson:"winningPlan"`
+	} `bson:"queryPlanner"`
+
+	ExecutionStats *struct {
+		Returned     int   `bson:"nReturned"`
+		KeysExamined int   `bson:"totalKeysExamined"`
+		DocsExamined int   `bson:"totalDocsExamined"`
+		Millis       int64 `bson:"executionTimeMillis"`
+	} `bson:"executionStats"`
+
+	// pipelines that aren't run by the query engine as a whole report the
+	// plan of the initial query in their first stage
+	Stages []struct {
+		Cursor *explainOutput `bson:"$cursor"`
+	} `bson:"stages"`
+}
+
+// ExplainFind returns the plan of a FindWithOptions query, opts may be nil.
+// The query is run to collect the statistics, e.g. to assert in staging that
+// a query uses an index
+func (db *DB) ExplainFind(coll string, query interface{}, opts *FindOptions) (*Explain, error) {
+	return db.explain(&Op{Name: "explain", Collection: coll, Query: query},
+		findCommand(coll, query, opts), "executionStats")
+}
+
+// ExplainPipe returns the plan of an aggregation pipeline, opts may be nil.
+// Only the initial query of the pipeline has a plan
+func (db *DB) ExplainPipe(coll string, query interface{}, opts *PipeOptions) (*Explain, error) {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return db.explain(&Op{Name: "explain", Collection: coll, Query: pipeline},
+		pipeCommand(coll, pipeline, opts), "executionStats")
+}
+
+func findCommand(coll string, query interface{}, opts *FindOptions) bson.D {
+	var cmd = bson.D{{Key: "find", Value: coll}, {Key: "filter", Value: filter(query)}}
+
+	if opts != nil {
+		if len(opts.Sort) > 0 {
+			cmd = append(cmd, bson.E{Key: "sort", Value: sortFields(opts.Sort...)})
+		}
+
+		if opts.Limit > 0 {
+			cmd = append(cmd, bson.E{Key: "limit", Value: opts.Limit})
+		}
+
+		if opts.Skip > 0 {
+			cmd = append(cmd, bson.E{Key: "skip", Value: opts.Skip})
+		}
+
+		if opts.Projection != nil {
+			cmd = append(cmd, bson.E{Key: "projection", Value: opts.Projection})
+		}
+
+		if opts.Hint != nil {
+			cmd = append(cmd, bson.E{Key: "hint", Value: opts.Hint})
+		}
+
+		if opts.Collation != nil {
+			cmd = append(cmd, bson.E{Key: "collation", Value: opts.Collation})
+		}
+	}
+
+	return cmd
+}
+
+func pipeCommand(coll string, pipeline interface{}, opts *PipeOptions) bson.D {
+	var cmd = bson.D{
+		{Key: "aggregate", Value: coll},
+		{Key: "pipeline", Value: pipeline},
+		{Key: "cursor", Value: bson.M{}},
+	}
+
+	if opts != nil && opts.Hint != nil {
+		cmd = append(cmd, bson.E{Key: "hint", Value: opts.Hint})
+	}
+
+	if opts != nil && opts.Collation != nil {
+		cmd = append(cmd, bson.E{Key: "collation", Value: opts.Collation})
+	}
+
+	return cmd
+}
+
+// explain runs cmd with the given verbosity, "queryPlanner" doesn't run the
+// query and leaves the statistics zero
+func (db *DB) explain(o *Op, cmd bson.D, verbosity string) (*Explain, error) {
+	var raw bson.Raw
+
+	var err = db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		return c.Database().RunCommand(ctx, bson.D{
+			{Key: "explain", Value: cmd},
+			{Key: "verbosity", Value: verbosity},
+		}).Decode(&raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseExplain(raw)
+}
+
+func parseExplain(raw bson.Raw) (*Explain, error) {
+	var out explainOutput
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+
+	for out.QueryPlanner == nil && len(out.Stages) > 0 && out.Stages[0].Cursor != nil {
+		out = *out.Stages[0].Cursor
+	}
+
+	var e = &Explain{Indexes: []string{}, Raw: raw}
+
+	if out.QueryPlanner != nil {
+		e.Plan = out.QueryPlanner.WinningPlan
+	}
+
+	e.Plan.walk(func(s *PlanStage) {
+		switch {
+		case s.Stage == "COLLSCAN":
+			e.CollScan = true
+		case s.IndexName != "":
+			e.Indexes = append(e.Indexes, s.IndexName)
+		}
+	})
+
+	if stats := out.ExecutionStats; stats != nil {
+		e.Returned = stats.Returned
+		e.KeysExamined = stats.KeysExamined
+		e.DocsExamined = stats.DocsExamined
+		e.Duration = time.Duration(stats.Millis) * time.Millisecond
+	}
+
+	return e, nil
+}
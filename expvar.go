@@ -0,0 +1,88 @@
+package mongo
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+const defaultExpvarName = "mongo"
+
+// expvars counts operations and errors per collection and operation
+type expvars struct {
+	ops    *expvar.Map
+	errors *expvar.Map
+}
+
+// WithExpvar publishes operation and error counters keyed by collection and
+// operation, e.g. "devices.find", as the expvar name, "mongo" if empty. They
+// show in /debug/vars next to the runtime stats:
+//
+//	"mongo": {"errors": {"devices.update": 2}, "ops": {"devices.find": 1289, ...}}
+//
+// Connections using the same name share the counters. A name published
+// already as something else, e.g. "memstats", makes NewConnection fail
+func WithExpvar(name string) Option {
+	if name == "" {
+		name = defaultExpvarName
+	}
+
+	return func(db *DB) {
+		var vars, err = publishExpvars(name)
+		if err != nil {
+			db.invalid(err)
+			return
+		}
+
+		db.vars = vars
+	}
+}
+
+// publishing serializes publishing expvars, expvar.Publish panics on names
+// published twice
+var publishing sync.Mutex
+
+func publishExpvars(name string) (*expvars, error) {
+	publishing.Lock()
+	defer publishing.Unlock()
+
+	var root *expvar.Map
+
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		root = expvar.NewMap(name)
+	case *expvar.Map:
+		root = v
+	default:
+		return nil, fmt.Errorf("expvar %q is published already as a %T", name, v)
+	}
+
+	return &expvars{ops: subMap(root, "ops"), errors: subMap(root, "errors")}, nil
+}
+
+func subMap(root *expvar.Map, key string) *expvar.Map {
+	if m, ok := root.Get(key).(*expvar.Map); ok {
+		return m
+	}
+
+	var m = new(expvar.Map).Init()
+
+	root.Set(key, m)
+
+	return m
+}
+
+func (v *expvars) observe(o *Op, err error) {
+	if v == nil {
+		return
+	}
+
+	var key = o.Collection + "." + o.Name
+
+	v.ops.Add(key, 1)
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		v.errors.Add(key, 1)
+	}
+}
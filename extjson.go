@@ -0,0 +1,19 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ToExtJSON renders doc as extended JSON as read by mongoimport and
+// Compass. Canonical keeps every BSON type, e.g. {"$numberInt": "1"},
+// relaxed renders numbers and dates plainly, which loses the width of
+// numbers. ObjectIds and dates keep their type either way
+func ToExtJSON(doc interface{}, canonical bool) ([]byte, error) {
+	return bson.MarshalExtJSON(doc, canonical, false)
+}
+
+// FromExtJSON decodes a document in canonical or relaxed extended JSON,
+// e.g. a line written by mongoexport, into v
+func FromExtJSON(data []byte, v interface{}) error {
+	return bson.UnmarshalExtJSON(data, false, v)
+}
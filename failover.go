@@ -0,0 +1,122 @@
+package mongo
+
+import (
+	"errors"
+	"time"
+)
+
+const defaultProbeInterval = 10 * time.Second
+
+// WithFallback adds clusters to fail over to when the one of the DSN passed
+// to NewConnection is unreachable, in order of preference. The cluster in
+// use is probed periodically, see WithProbeInterval: when it lost its
+// primary the next reachable cluster takes over, and as soon as a preferred
+// one is reachable again operations fail back to it. Operations running
+// during a switch finish on the old cluster, handles follow the switch.
+// Lazy connecting is ignored since a cluster is only used once it answered
+func WithFallback(dsns ...string) Option {
+	return func(db *DB) {
+		db.fallbacks = append(db.fallbacks, dsns...)
+	}
+}
+
+// WithProbeInterval sets how often clusters are probed with WithFallback,
+// 10 seconds by default
+func WithProbeInterval(d time.Duration) Option {
+	return func(db *DB) {
+		db.probeInterval = d
+	}
+}
+
+// dialFailover connects to the first reachable of dsn and the fallbacks and
+// keeps probing them in the background until db is disconnected
+func (db *DB) dialFailover(dsn string, timeout time.Duration) error {
+	var (
+		dsns = append([]string{dsn}, db.fallbacks...)
+		errs []error
+	)
+
+	for _, dsn := range dsns {
+		var c, err = db.open(dsn, timeout, true)
+		if err != nil {
+			errs = append(errs, redactError(err, dsn))
+			continue
+		}
+
+		db.use(c, timeout)
+
+		var interval = db.probeInterval
+		if interval <= 0 {
+			interval = defaultProbeInterval
+		}
+
+		go db.probeClusters(db.link, dsns, timeout, interval)
+
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// probeClusters switches to a preferred cluster once it is reachable and
+// to any reachable one when the cluster in use lost its primary. It stops
+// once l is no longer in use or points to another deployment
+func (db *DB) probeClusters(l *link, dsns []string, timeout, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var cur = l.current()
+		if cur == nil {
+			return
+		}
+
+		var (
+			candidates []string
+			known      bool
+			up         = cur.monitor.isUp()
+		)
+
+		// while the cluster in use is up only the preferred ones before
+		// it are worth switching to
+		for _, dsn := range dsns {
+			if dsn == cur.dsn {
+				if known = true; up {
+					break
+				}
+
+				continue
+			}
+
+			candidates = append(candidates, dsn)
+		}
+
+		if !known {
+			// connected elsewhere meanwhile
+			return
+		}
+
+		for _, dsn := range candidates {
+			var c, err = db.open(dsn, timeout, true)
+			if err != nil {
+				continue
+			}
+
+			if !l.replace(cur, c) {
+				// disconnected or connected elsewhere meanwhile
+				c.close()
+				return
+			}
+
+			db.logger().Warnf("mongo: switched from %s to %s",
+				RedactDSN(cur.dsn), RedactDSN(dsn))
+
+			go cur.closeIdle()
+
+			c.monitor.activate()
+
+			break
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collation for locale aware string comparison, e.g. &Collation{Locale: "en",
+// Strength: 2} compares case-insensitively
+type Collation = options.Collation
+
+// CaseInsensitive returns a collation comparing strings without regard to
+// case, as used by FindCI and CreateUniqueIndexCI
+func CaseInsensitive() *Collation {
+	return &Collation{Locale: "en", Strength: 2}
+}
+
+// FindOptions for FindWithOptions and FindOneWithOptions, zero values are
+// left unset
+type FindOptions struct {
+	// Sort fields in mgo notation, e.g. "-created" for descending order
+	Sort []string
+
+	Limit int
+	Skip  int
+
+	// Projection selects the returned fields, e.g. M{"name": 1}
+	Projection interface{}
+
+	// Hint forces an index, either by name or by key document
+	Hint interface{}
+
+	// Collation applies to the query and the sort
+	Collation *Collation
+
+	// Total receives the number of documents matching the query regardless
+	// of Limit and Skip, counted along with the page like FindPage does, so
+	// Limit must be positive. It is ignored by FindOneWithOptions
+	Total *int
+}
+
+func (o *FindOptions) find() *options.FindOptions {
+	var opts = options.Find()
+	if o == nil {
+		return opts
+	}
+
+	if len(o.Sort) > 0 {
+		opts.SetSort(sortFields(o.Sort...))
+	}
+
+	if o.Limit > 0 {
+		opts.SetLimit(int64(o.Limit))
+	}
+
+	if o.Skip > 0 {
+		opts.SetSkip(int64(o.Skip))
+	}
+
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection)
+	}
+
+	if o.Hint != nil {
+		opts.SetHint(o.Hint)
+	}
+
+	if o.Collation != nil {
+		opts.SetCollation(o.Collation)
+	}
+
+	return opts
+}
+
+func (o *FindOptions) findOne() *options.FindOneOptions {
+	var opts = options.FindOne()
+	if o == nil {
+		return opts
+	}
+
+	if len(o.Sort) > 0 {
+		opts.SetSort(sortFields(o.Sort...))
+	}
+
+	if o.Skip > 0 {
+		opts.SetSkip(int64(o.Skip))
+	}
+
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection)
+	}
+
+	if o.Hint != nil {
+		opts.SetHint(o.Hint)
+	}
+
+	if o.Collation != nil {
+		opts.SetCollation(o.Collation)
+	}
+
+	return opts
+}
+
+// FindWithOptions decodes all documents matching query into v, opts may be nil
+func (db *DB) FindWithOptions(coll string, query interface{}, v interface{},
+	opts *FindOptions) error {
+	if opts != nil && opts.Total != nil {
+		var total, err = db.findPage(coll, query, opts, v)
+		if err != nil {
+			return err
+		}
+
+		*opts.Total = total
+
+		return nil
+	}
+
+	return db.findAll(coll, query, opts.find(), v)
+}
+
+// FindOneWithOptions decodes the first document matching query into v,
+// opts may be nil
+func (db *DB) FindOneWithOptions(coll string, query interface{}, v interface{},
+	opts *FindOptions) error {
+	return db.findOne(coll, query, opts.findOne(), v)
+}
+
+// FindWithProjection decodes the fields selected by projection of all
+// documents matching query into v, e.g. M{"name": 1, "_id": 0}
+func (db *DB) FindWithProjection(coll string, query interface{}, projection interface{},
+	v interface{}) error {
+	return db.FindWithOptions(coll, query, v, &FindOptions{Projection: projection})
+}
+
+// FindCI decodes all documents matching query into v comparing strings
+// without regard to case, e.g. M{"email": "Bob@example.com"} finds
+// bob@example.com. It uses indexes created by CreateUniqueIndexCI
+func (db *DB) FindCI(coll string, query interface{}, v interface{}) error {
+	return db.FindWithOptions(coll, query, v, &FindOptions{Collation: CaseInsensitive()})
+}
+
+// FindOneWithProjection is FindWithProjection for the first matching document
+func (db *DB) FindOneWithProjection(coll string, query interface{}, projection interface{},
+	v interface{}) error {
+	return db.FindOneWithOptions(coll, query, v, &FindOptions{Projection: projection})
+}
+
+// Distinct decodes the unique values of field among the documents matching
+// query into result, which must be a pointer to a slice
+func (db *DB) Distinct(coll string, field string, query interface{}, result interface{}) error {
+	var o = &Op{Name: "distinct", Collection: coll, Query: query, Result: result}
+
+	return db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		var values, err = c.Distinct(ctx, field, filter(query),
+			options.Distinct().SetMaxTime(db.maxTime(coll)).SetComment(commentValue(ctx)))
+		if err != nil {
+			return err
+		}
+
+		o.N = len(values)
+
+		raw, err := bson.Marshal(bson.M{"values": values})
+		if err != nil {
+			return err
+		}
+
+		return bson.Raw(raw).Lookup("values").Unmarshal(result)
+	})
+}
+
+// FindPage decodes the documents matching query sorted by sort, an mgo
+// notation field that may be empty, after skipping offset and up to limit
+// into v, and returns how many match in total. It takes a single
+// aggregation, so page and total are consistent. The page must fit into a
+// 16MB document, so limit must be positive
+func (db *DB) FindPage(coll string, query interface{}, sort string,
+	limit, offset int, v interface{}) (int, error) {
+	var opts = &FindOptions{Limit: limit, Skip: offset}
+
+	if sort != "" {
+		opts.Sort = []string{sort}
+	}
+
+	return db.findPage(coll, query, opts, v)
+}
+
+// findPage decodes the page of opts into v and returns the number of all
+// documents matching query, both from a single $facet
+func (db *DB) findPage(coll string, query interface{}, opts *FindOptions, v interface{}) (int, error) {
+	// all matches in a single reply would fail on large collections
+	if opts.Limit <= 0 {
+		return 0, fmt.Errorf("%s: %w: a total needs a limit", coll, ErrInvalidQuery)
+	}
+
+	var result page
+
+	var aggregate = options.Aggregate()
+
+	if opts.Hint != nil {
+		aggregate.SetHint(opts.Hint)
+	}
+
+	if opts.Collation != nil {
+		aggregate.SetCollation(opts.Collation)
+	}
+
+	if err := db.pipeOne(coll, pagePipeline(query, opts), aggregate, &result); err != nil {
+		return 0, err
+	}
+
+	var total, err = result.decode(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return total, nil
+}
+
+// page is the result of pagePipeline
+type page struct {
+	Items bson.RawValue `bson:"items"`
+	Total []struct {
+		N int `bson:"n"`
+	} `bson:"total"`
+}
+
+// decode decodes the items into v and returns the total, there is none if
+// nothing matched
+func (p *page) decode(v interface{}) (int, error) {
+	if err := p.Items.Unmarshal(v); err != nil {
+		return 0, err
+	}
+
+	if len(p.Total) == 0 {
+		return 0, nil
+	}
+
+	return p.Total[0].N, nil
+}
+
+// pagePipeline returns the aggregation of findPage, the documents matching
+// query as items shaped by opts and their number as total. The sort comes
+// before $facet, where it couldn't use an index
+func pagePipeline(query interface{}, opts *FindOptions) []bson.M {
+	var pipeline = []bson.M{{"$match": filter(query)}}
+
+	if len(opts.Sort) > 0 {
+		pipeline = append(pipeline, bson.M{"$sort": sortFields(opts.Sort...)})
+	}
+
+	var page = bson.A{}
+
+	if opts.Skip > 0 {
+		page = append(page, bson.M{"$skip": opts.Skip})
+	}
+
+	if opts.Limit > 0 {
+		page = append(page, bson.M{"$limit": opts.Limit})
+	}
+
+	if opts.Projection != nil {
+		page = append(page, bson.M{"$project": opts.Projection})
+	}
+
+	// the server rejects empty sub-pipelines
+	if len(page) == 0 {
+		page = append(page, bson.M{"$match": bson.M{}})
+	}
+
+	return append(pipeline, bson.M{"$facet": bson.D{
+		{Key: "items", Value: page},
+		{Key: "total", Value: bson.A{bson.M{"$count": "n"}}},
+	}})
+}
+
+// FindAfter decodes up to limit documents matching query into v, ordered
+// by sort, a comma separated list of fields in mgo notation, e.g.
+// "-created,name". It starts after the document token was made from, or at
+// the beginning with an empty token, and returns the token of the next page,
+// empty on the last one. Unlike offsets, pages deep into a collection are as
+// fast as the first if an index covers the sort. _id breaks ties, the sort
+// fields should exist in all documents
+func (db *DB) FindAfter(coll string, query interface{}, sort string, limit int,
+	token string, v interface{}) (string, error) {
+	if limit <= 0 {
+		return "", fmt.Errorf("%s: %w: limit %d is not positive", coll, ErrInvalidQuery, limit)
+	}
+
+	var keys, err = keysetFields(sort)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: sort: %v", coll, ErrInvalidQuery, err)
+	}
+
+	var (
+		order = strings.Join(keys, ",")
+		after = filter(query)
+		raws  = []bson.Raw{}
+	)
+
+	if token != "" {
+		var values, err = decodeToken(token, order)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", coll, err)
+		}
+
+		after = bson.D{{Key: "$and", Value: bson.A{after, keysetFilter(keys, values)}}}
+	}
+
+	err = db.findAll(coll, after, options.Find().
+		SetSort(sortFields(keys...)).
+		SetLimit(int64(limit)+1), &raws)
+	if err != nil {
+		return "", err
+	}
+
+	var next string
+
+	if len(raws) > limit {
+		raws = raws[:limit]
+
+		if next, err = encodeToken(raws[limit-1], keys, order); err != nil {
+			return "", fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+
+	if err = decodeRaws(raws, v); err != nil {
+		return "", fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return next, nil
+}
+
+// decodeRaws decodes documents into v, a pointer to a slice
+func decodeRaws(raws []bson.Raw, v interface{}) error {
+	var typ, data, err = bson.MarshalValue(raws)
+	if err != nil {
+		return err
+	}
+
+	return bson.RawValue{Type: typ, Value: data}.Unmarshal(v)
+}
+
+// keysetFields returns the sort fields of sort with _id appended, so that
+// they are unique
+func keysetFields(sort string) ([]string, error) {
+	var keys []string
+
+	if sort != "" {
+		var err error
+		if keys, err = parseSort(sort, func(string) bool { return true }); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range keys {
+		if strings.TrimLeft(key, "+-") == "_id" {
+			return keys, nil
+		}
+	}
+
+	if len(keys) > 0 && strings.HasPrefix(keys[len(keys)-1], "-") {
+		return append(keys, "-_id"), nil
+	}
+
+	return append(keys, "_id"), nil
+}
+
+// keysetFilter matches the documents sorted after values, e.g. for
+// "-created,_id" {$or: [{created: {$lt: c}}, {created: c, _id: {$gt: id}}]}
+func keysetFilter(keys []string, values []bson.RawValue) bson.D {
+	var clauses = bson.A{}
+
+	for i, key := range keys {
+		var clause = bson.D{}
+
+		for j := 0; j < i; j++ {
+			clause = append(clause, bson.E{Key: strings.TrimLeft(keys[j], "+-"), Value: values[j]})
+		}
+
+		var op = "$gt"
+		if strings.HasPrefix(key, "-") {
+			op = "$lt"
+		}
+
+		clause = append(clause, bson.E{Key: strings.TrimLeft(key, "+-"), Value: bson.D{{Key: op, Value: values[i]}}})
+		clauses = append(clauses, clause)
+	}
+
+	return bson.D{{Key: "$or", Value: clauses}}
+}
+
+// keysetToken is the content of a FindAfter token, the sort it was made for
+// and the values of its fields in the last document
+type keysetToken struct {
+	Sort   string          `bson:"s"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+func encodeToken(last bson.Raw, keys []string, order string) (string, error) {
+	var token = keysetToken{Sort: order}
+
+	for _, key := range keys {
+		var value, err = last.LookupErr(strings.Split(strings.TrimLeft(key, "+-"), ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+
+		token.Values = append(token.Values, value)
+	}
+
+	var data, err = bson.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeToken(s, order string) ([]bson.RawValue, error) {
+	var (
+		token     keysetToken
+		data, err = base64.RawURLEncoding.DecodeString(s)
+	)
+
+	if err == nil {
+		err = bson.Unmarshal(data, &token)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidQuery)
+	}
+
+	if token.Sort != order || len(token.Values) != len(strings.Split(order, ",")) {
+		return nil, fmt.Errorf("%w: token is for sort %q", ErrInvalidQuery, token.Sort)
+	}
+
+	return token.Values, nil
+}
+
+// CountOptions for CountWithOptions, zero values are left unset
+type CountOptions struct {
+	// Limit stops counting at this number, e.g. to tell "more than 1000"
+	Limit int
+	Skip  int
+
+	// MaxTime replaces the server-side time limit, see WithMaxTimeMS
+	MaxTime time.Duration
+
+	Hint      interface{}
+	Collation *Collation
+}
+
+func (o *CountOptions) count() *options.CountOptions {
+	var opts = options.Count()
+	if o == nil {
+		return opts
+	}
+
+	if o.Limit > 0 {
+		opts.SetLimit(int64(o.Limit))
+	}
+
+	if o.Skip > 0 {
+		opts.SetSkip(int64(o.Skip))
+	}
+
+	if o.MaxTime > 0 {
+		opts.SetMaxTime(o.MaxTime)
+	}
+
+	if o.Hint != nil {
+		opts.SetHint(o.Hint)
+	}
+
+	if o.Collation != nil {
+		opts.SetCollation(o.Collation)
+	}
+
+	return opts
+}
+
+// CountWithOptions counts the documents matching query, opts may be nil
+func (db *DB) CountWithOptions(coll string, query interface{}, opts *CountOptions) (int, error) {
+	return db.count(coll, query, opts.count())
+}
+
+// EstimatedCount returns the number of documents in coll from its metadata
+// without scanning it. It is fast on huge collections but may be off after
+// an unclean shutdown or with orphaned documents on sharded clusters
+func (db *DB) EstimatedCount(coll string) (int, error) {
+	var n int64
+
+	var err = db.read(&Op{Name: "estimatedCount", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var err error
+
+		n, err = c.EstimatedDocumentCount(ctx, options.EstimatedDocumentCount().
+			SetMaxTime(db.maxTime(coll)).SetComment(commentValue(ctx)))
+
+		return err
+	})
+
+	return int(n), err
+}
+
+// Exists reports whether a document matches query, only its _id is fetched
+func (db *DB) Exists(coll string, query interface{}) (bool, error) {
+	var doc bson.Raw
+
+	var err = db.findOne(coll, query, options.FindOne().SetProjection(bson.M{"_id": 1}), &doc)
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// earthRadius in meters, as used by the server for spherical geometry
+const earthRadius = 6378100
+
+// Point is a GeoJSON point, store it in documents to use the geo helpers
+type Point struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewPoint returns a GeoJSON point, note that longitude comes first
+func NewPoint(lon, lat float64) Point {
+	return Point{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+// Polygon is a GeoJSON polygon with a single outer ring
+type Polygon struct {
+	Type        string        `bson:"type" json:"type"`
+	Coordinates [][][]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewPolygon returns a GeoJSON polygon of [lon, lat] vertices, the ring is
+// closed if the last vertex differs from the first
+func NewPolygon(vertices ...[2]float64) Polygon {
+	var ring = make([][]float64, 0, len(vertices)+1)
+
+	for _, v := range vertices {
+		ring = append(ring, []float64{v[0], v[1]})
+	}
+
+	if n := len(vertices); n > 0 && vertices[0] != vertices[n-1] {
+		ring = append(ring, []float64{vertices[0][0], vertices[0][1]})
+	}
+
+	return Polygon{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
+
+// CreateGeoIndex creates a 2dsphere index on field
+func (db *DB) CreateGeoIndex(coll string, field string) error {
+	return db.CreateIndex(coll, Index{Keys: []string{"$2dsphere:" + field}})
+}
+
+// FindNear decodes the documents whose field is within maxMeters of the
+// point into v, nearest first. maxMeters <= 0 means no distance limit.
+// field needs a 2dsphere index
+func (db *DB) FindNear(coll string, field string, lon, lat float64,
+	maxMeters float64, v interface{}) error {
+	var near = bson.M{"$geometry": NewPoint(lon, lat)}
+
+	if maxMeters > 0 {
+		near["$maxDistance"] = maxMeters
+	}
+
+	return db.findAll(coll, bson.M{field: bson.M{"$near": near}}, options.Find(), v)
+}
+
+// FindWithinRadius decodes the documents whose field is within radiusMeters
+// of the point into v, unlike FindNear the result is not ordered
+func (db *DB) FindWithinRadius(coll string, field string, lon, lat float64,
+	radiusMeters float64, v interface{}) error {
+	var within = bson.M{"$centerSphere": bson.A{
+		bson.A{lon, lat}, radiusMeters / earthRadius,
+	}}
+
+	return db.findAll(coll, bson.M{field: bson.M{"$geoWithin": within}}, options.Find(), v)
+}
+
+// FindWithinPolygon decodes the documents whose field lies inside polygon
+func (db *DB) FindWithinPolygon(coll string, field string, polygon Polygon, v interface{}) error {
+	var within = bson.M{"$geometry": polygon}
+
+	return db.findAll(coll, bson.M{field: bson.M{"$geoWithin": within}}, options.Find(), v)
+}
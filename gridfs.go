@@ -0,0 +1,191 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// File is the description of a file stored in GridFS
+type File struct {
+	ID         interface{} `bson:"_id"`
+	Name       string      `bson:"filename"`
+	Length     int64       `bson:"length"`
+	ChunkSize  int32       `bson:"chunkSize"`
+	UploadDate time.Time   `bson:"uploadDate"`
+	Metadata   bson.Raw    `bson:"metadata,omitempty"`
+}
+
+// gridfs runs fn with the GridFS bucket name, "fs" if empty, through exec
+// like operations on collections, reported for the files collection of the
+// bucket. Uploads and downloads are not bound by the operation timeouts
+// since files can be large
+func (db *DB) gridfs(o *Op, bucket string, fn func(context.Context, *gridfs.Bucket) error) error {
+	if bucket == "" {
+		bucket = options.DefaultName
+	}
+
+	o.Collection = bucket + ".files"
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var b, err = newBucket(c.Database(), bucket)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx, b)
+	})
+}
+
+// newBucket opens the GridFS bucket name of d, "fs" if empty
+func newBucket(d *mongo.Database, name string) (*gridfs.Bucket, error) {
+	var opts = options.GridFSBucket()
+	if name != "" {
+		opts.SetName(name)
+	}
+
+	return gridfs.NewBucket(d, opts)
+}
+
+// fileError wraps err of the file name, a missing file is ErrNotFound
+func fileError(name string, err error) error {
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		err = ErrNotFound
+	}
+
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// PutFile stores the content of r in bucket under name and returns the id
+// of the new file, storing the same name again creates a new revision
+func (db *DB) PutFile(bucket, name string, r io.Reader) (primitive.ObjectID, error) {
+	return db.PutFileWithMetadata(bucket, name, r, nil)
+}
+
+// PutFileWithMetadata works like PutFile and attaches metadata to the file,
+// it can be filtered on with ListFiles, e.g. M{"metadata.model": "wl-300"}
+func (db *DB) PutFileWithMetadata(bucket, name string, r io.Reader,
+	metadata interface{}) (primitive.ObjectID, error) {
+	var opts = options.GridFSUpload()
+	if metadata != nil {
+		opts.SetMetadata(metadata)
+	}
+
+	var (
+		id primitive.ObjectID
+		o  = &Op{Name: "putFile", Query: bson.M{"filename": name}}
+	)
+
+	var err = db.gridfs(o, bucket, func(ctx context.Context, b *gridfs.Bucket) error {
+		var err error
+
+		if id, err = b.UploadFromStream(name, r, opts); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		o.N = 1
+		o.IDs = []interface{}{id}
+
+		return nil
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return id, nil
+}
+
+// GetFile writes the latest revision of the file name to w and returns the
+// number of bytes written
+func (db *DB) GetFile(bucket, name string, w io.Writer) (int64, error) {
+	var (
+		n int64
+		o = &Op{Name: "getFile", Query: bson.M{"filename": name}}
+	)
+
+	var err = db.gridfs(o, bucket, func(ctx context.Context, b *gridfs.Bucket) error {
+		var err error
+
+		if n, err = b.DownloadToStreamByName(name, w); err != nil {
+			return fileError(name, err)
+		}
+
+		o.N = 1
+
+		return nil
+	})
+
+	return n, err
+}
+
+// DeleteFile removes all revisions of the file name
+func (db *DB) DeleteFile(bucket, name string) error {
+	var o = &Op{Name: "deleteFile", Query: bson.M{"filename": name}}
+
+	return db.gridfs(o, bucket, func(ctx context.Context, b *gridfs.Bucket) error {
+		var files, err = listFiles(ctx, b, o.Query)
+		if err != nil {
+			return err
+		}
+
+		if len(files) == 0 {
+			return fmt.Errorf("%s: %w", name, ErrNotFound)
+		}
+
+		for _, file := range files {
+			if err = b.DeleteContext(ctx, file.ID); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			o.N++
+			o.IDs = append(o.IDs, file.ID)
+		}
+
+		return nil
+	})
+}
+
+// ListFiles returns the files of bucket matching query, it is applied to
+// the files collection so metadata is matched with "metadata.<field>" keys
+func (db *DB) ListFiles(bucket string, query interface{}) ([]File, error) {
+	var (
+		files = []File{}
+		o     = &Op{Name: "listFiles", Query: query, Result: &files}
+	)
+
+	var err = db.gridfs(o, bucket, func(ctx context.Context, b *gridfs.Bucket) error {
+		var err error
+
+		files, err = listFiles(ctx, b, query)
+		o.N = len(files)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func listFiles(ctx context.Context, b *gridfs.Bucket, query interface{}) ([]File, error) {
+	var cur, err = b.FindContext(ctx, filter(query),
+		options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var files = []File{}
+
+	err = cur.All(ctx, &files)
+
+	return files, err
+}
@@ -0,0 +1,80 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// healthTimeout bounds the ping of HealthHandler
+const healthTimeout = 5 * time.Second
+
+// HealthReport is the response of HealthHandler
+type HealthReport struct {
+	Connected bool `json:"connected"`
+
+	// Healthy is the state of the last heartbeat, see Healthy
+	Healthy bool `json:"healthy"`
+
+	// Ping is the round-trip time to the primary in milliseconds
+	Ping  float64 `json:"pingMs"`
+	Error string  `json:"error,omitempty"`
+
+	Pool PoolStats `json:"pool"`
+}
+
+// Ping round-trips to the primary, use it for probes that must reflect the
+// current connectivity, e.g. readiness
+func (db *DB) Ping(ctx context.Context) error {
+	var client = db.mongoClient()
+	if client == nil {
+		return ErrNotConnected
+	}
+
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// Healthy reports the last known state of the connection without network
+// access: whether the primary answered the last heartbeat of the driver,
+// which runs every 10 seconds. Cheap enough for frequent liveness probes
+func (db *DB) Healthy() bool {
+	var c = db.link.current()
+
+	return c != nil && c.monitor.isUp()
+}
+
+// HealthHandler serves a HealthReport as JSON, e.g. for /healthz/mongo. It
+// pings the primary for every request and responds 503 Service Unavailable
+// if that fails
+func (db *DB) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ctx, cancel = context.WithTimeout(r.Context(), healthTimeout)
+
+		defer cancel()
+
+		var (
+			report = HealthReport{
+				Connected: db.IsConnected(),
+				Healthy:   db.Healthy(),
+				Pool:      db.Stats(),
+			}
+			status = http.StatusOK
+			start  = time.Now()
+		)
+
+		if err := db.Ping(ctx); err != nil {
+			report.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		} else {
+			report.Ping = float64(time.Since(start)) / float64(time.Millisecond)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
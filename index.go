@@ -0,0 +1,219 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index describes an index for CreateIndex
+type Index struct {
+	// Keys in mgo notation: "name", "-created", "$text:title", "$2dsphere:loc"
+	Keys []string
+
+	// Name defaults to the one generated by the server from the keys
+	Name string
+
+	Unique     bool
+	Sparse     bool
+	Background bool
+
+	// ExpireAfter turns a single date field index into a TTL index, it must
+	// be whole seconds
+	ExpireAfter time.Duration
+
+	// TTL makes a TTL index even with ExpireAfter zero, which expires
+	// documents at the time of their date field
+	TTL bool
+
+	// PartialFilter limits the index to the documents matching it
+	PartialFilter interface{}
+
+	// Collation of the index, queries use it only with the same collation
+	Collation *Collation
+}
+
+func (index Index) model() (mongo.IndexModel, error) {
+	var opts = options.Index()
+
+	if len(index.Keys) == 0 {
+		return mongo.IndexModel{}, fmt.Errorf("%w: index without keys", ErrInvalidQuery)
+	}
+
+	if index.ExpireAfter < 0 || index.ExpireAfter%time.Second != 0 {
+		return mongo.IndexModel{}, fmt.Errorf("%w: expiry %v is not whole seconds", ErrInvalidQuery, index.ExpireAfter)
+	}
+
+	if index.Name != "" {
+		opts.SetName(index.Name)
+	}
+
+	if index.Unique {
+		opts.SetUnique(true)
+	}
+
+	if index.Sparse {
+		opts.SetSparse(true)
+	}
+
+	if index.Background {
+		opts.SetBackground(true)
+	}
+
+	if index.TTL || index.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(index.ExpireAfter / time.Second))
+	}
+
+	if index.PartialFilter != nil {
+		opts.SetPartialFilterExpression(index.PartialFilter)
+	}
+
+	if index.Collation != nil {
+		opts.SetCollation(index.Collation)
+	}
+
+	return mongo.IndexModel{Keys: indexKeys(index.Keys...), Options: opts}, nil
+}
+
+// CreateIndex creates index on coll if it doesn't exist yet
+func (db *DB) CreateIndex(coll string, index Index) error {
+	var model, err = index.model()
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return db.exec(&Op{Name: "createIndex", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var _, err = c.Indexes().CreateOne(ctx, model)
+
+		return err
+	})
+}
+
+// CreateUniqueIndexCI creates a unique index on keys of coll that ignores
+// case, so that e.g. two users can't sign up as bob@example.com and
+// Bob@example.com. Inserts violating it fail with a duplicate key error,
+// see mongo.IsDuplicateKeyError. FindCI queries use it
+func (db *DB) CreateUniqueIndexCI(coll string, keys ...string) error {
+	return db.CreateIndex(coll, Index{Keys: keys, Unique: true, Collation: CaseInsensitive()})
+}
+
+// IndexSpec describes an existing index as returned by ListIndexes
+type IndexSpec struct {
+	Name               string   `bson:"name"`
+	Key                bson.D   `bson:"key"`
+	Unique             bool     `bson:"unique,omitempty"`
+	Sparse             bool     `bson:"sparse,omitempty"`
+	ExpireAfterSeconds *int32   `bson:"expireAfterSeconds,omitempty"`
+	PartialFilter      bson.Raw `bson:"partialFilterExpression,omitempty"`
+	Version            int32    `bson:"v"`
+}
+
+// ListIndexes returns the indexes of coll, including the one on _id
+func (db *DB) ListIndexes(coll string) ([]IndexSpec, error) {
+	var indexes = []IndexSpec{}
+
+	var err = db.read(&Op{Name: "listIndexes", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Indexes().List(ctx)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &indexes)
+	})
+
+	return indexes, err
+}
+
+// DropIndex removes the index with the given name from coll
+func (db *DB) DropIndex(coll string, name string) error {
+	return db.exec(&Op{Name: "dropIndex", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var _, err = c.Indexes().DropOne(ctx, name)
+
+		return err
+	})
+}
+
+// DropAllIndexes removes all indexes of coll except the one on _id
+func (db *DB) DropAllIndexes(coll string) error {
+	return db.exec(&Op{Name: "dropIndex", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var _, err = c.Indexes().DropAll(ctx)
+
+		return err
+	})
+}
+
+// IndexUsage is how often an index was used since the server started or the
+// index was created
+type IndexUsage struct {
+	Name  string
+	Key   bson.D
+	Ops   int64
+	Since time.Time
+}
+
+type indexStats struct {
+	Name     string `bson:"name"`
+	Key      bson.D `bson:"key"`
+	Accesses struct {
+		Ops   int64     `bson:"ops"`
+		Since time.Time `bson:"since"`
+	} `bson:"accesses"`
+}
+
+// IndexUsage reports the usage of the indexes of coll, least used first, to
+// find indexes that can be dropped. The counts of all shards are summed up,
+// on a replica set only the member read from is accounted for
+func (db *DB) IndexUsage(coll string) ([]IndexUsage, error) {
+	var stats []indexStats
+
+	var err = db.read(&Op{Name: "indexStats", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Aggregate(ctx, []bson.M{{"$indexStats": bson.M{}}})
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return indexUsage(stats), nil
+}
+
+func indexUsage(stats []indexStats) []IndexUsage {
+	var (
+		usage  = []IndexUsage{}
+		byName = map[string]int{}
+	)
+
+	for _, s := range stats {
+		var i, ok = byName[s.Name]
+		if !ok {
+			i = len(usage)
+			byName[s.Name] = i
+			usage = append(usage, IndexUsage{Name: s.Name, Key: s.Key, Since: s.Accesses.Since})
+		}
+
+		usage[i].Ops += s.Accesses.Ops
+
+		if s.Accesses.Since.Before(usage[i].Since) {
+			usage[i].Since = s.Accesses.Since
+		}
+	}
+
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].Ops != usage[j].Ops {
+			return usage[i].Ops < usage[j].Ops
+		}
+
+		return usage[i].Name < usage[j].Name
+	})
+
+	return usage
+}
@@ -0,0 +1,226 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Iter decodes the results of a query one at a time, fetching them from
+// the server in batches. It must be closed
+type Iter struct {
+	cur    *mongo.Cursor
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *conn
+	ops    *inflight
+	err    error
+	close  sync.Once
+}
+
+// Next decodes the next result into v, it returns false once all results
+// were returned or the iteration failed, see Err
+func (it *Iter) Next(v interface{}) bool {
+	if it.err != nil || it.cur == nil || !it.cur.Next(it.ctx) {
+		return false
+	}
+
+	if it.err = it.cur.Decode(v); it.err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (it *Iter) Err() error {
+	if it.err != nil || it.cur == nil {
+		return it.err
+	}
+
+	return it.cur.Err()
+}
+
+// Close releases the server cursor, it is safe to call more than once
+func (it *Iter) Close() error {
+	var err error
+
+	it.close.Do(func() {
+		defer it.ops.leave()
+		defer it.conn.users.Done()
+
+		it.cancel()
+
+		if it.cur != nil {
+			err = it.cur.Close(context.Background())
+		}
+	})
+
+	return err
+}
+
+// PipeIter runs the aggregation query and returns an Iter over its results
+// for result sets that don't fit into memory. batchSize sets how many
+// results are fetched at a time, the server default if zero
+func (db *DB) PipeIter(coll string, query interface{}, batchSize int) (*Iter, error) {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var opts = options.Aggregate()
+
+	if batchSize > 0 {
+		opts.SetBatchSize(int32(batchSize))
+	}
+
+	var o = &Op{Name: "aggregate", Collection: coll, Query: pipeline}
+
+	return db.iter(o, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Aggregate(ctx, pipeline, db.pipeOptions(coll, opts),
+			&options.AggregateOptions{Comment: comment(ctx)})
+	})
+}
+
+// ForEach calls fn with each document matching query, fetching batchSize
+// documents at a time or the server default if zero, e.g. for migrations
+// over whole collections, which is why the server-side time limit doesn't
+// apply. It stops at the first error of fn and returns it. fn may keep raw
+func (db *DB) ForEach(coll string, query interface{}, batchSize int, fn func(raw bson.Raw) error) error {
+	var opts = options.Find()
+
+	if batchSize > 0 {
+		opts.SetBatchSize(int32(batchSize))
+	}
+
+	var o = &Op{Name: "find", Collection: coll, Query: query}
+
+	var it, err = db.iter(o, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, filter(query), opts, &options.FindOptions{Comment: comment(ctx)})
+	})
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	var raw bson.Raw
+
+	for it.Next(&raw) {
+		if err = fn(raw); err != nil {
+			return err
+		}
+	}
+
+	if err = it.Err(); err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	return nil
+}
+
+// iter opens a cursor with open and returns an Iter over it
+func (db *DB) iter(o *Op, open func(context.Context, *mongo.Collection) (*mongo.Cursor, error)) (*Iter, error) {
+	var c = db.link.acquire()
+	if c == nil {
+		return nil, ErrNotConnected
+	}
+
+	// the Iter counts as running for Shutdown until it is closed
+	if !db.ops.enter() {
+		c.users.Done()
+		return nil, ErrShutdown
+	}
+
+	var cur *mongo.Cursor
+
+	var err = db.read(o, func(ctx context.Context, coll *mongo.Collection) error {
+		var err error
+
+		cur, err = open(ctx, coll)
+
+		return err
+	})
+	if err != nil {
+		c.users.Done()
+		db.ops.leave()
+
+		return nil, err
+	}
+
+	// the cursor outlives the operation, it keeps c from being closed
+	// until the Iter is
+	var ctx, cancel = context.WithCancel(db.parent())
+
+	return &Iter{cur: cur, ctx: ctx, cancel: cancel, conn: c, ops: db.ops}, nil
+}
+
+// Result is a document delivered by FindChan
+type Result bson.Raw
+
+// Decode decodes the document into v
+func (r Result) Decode(v interface{}) error {
+	return bson.Unmarshal(r, v)
+}
+
+// FindChan sends the documents matching query over the returned channel as
+// they are fetched, it blocks while the channel isn't read, so that workers
+// ranging over it set the pace. The channel is closed after the last
+// document or a failure. stop ends the query early if the channel wasn't
+// drained and returns its error, it must be called either way
+func (db *DB) FindChan(coll string, query interface{}) (<-chan Result, func() error) {
+	return stream(db, coll, query, func(raw bson.Raw) (Result, error) {
+		return Result(raw), nil
+	})
+}
+
+// errStopped ends a stream whose consumer called stop
+var errStopped = errors.New("stopped")
+
+// stream sends the documents matching query over a channel as decoded by
+// decode, see FindChan
+func stream[T any](db *DB, coll string, query interface{},
+	decode func(bson.Raw) (T, error)) (<-chan T, func() error) {
+	var (
+		ch   = make(chan T)
+		quit = make(chan struct{})
+		done = make(chan struct{})
+		once sync.Once
+		err  error
+	)
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+
+		err = db.ForEach(coll, query, 0, func(raw bson.Raw) error {
+			var v, err = decode(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", coll, err)
+			}
+
+			select {
+			case ch <- v:
+				return nil
+			case <-quit:
+				return errStopped
+			}
+		})
+	}()
+
+	return ch, func() error {
+		once.Do(func() { close(quit) })
+
+		<-done
+
+		if errors.Is(err, errStopped) {
+			return nil
+		}
+
+		return err
+	}
+}
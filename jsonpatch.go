@@ -0,0 +1,261 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// patchOp is an operation of a JSON Patch
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) to the document with id in
+// a single update. add and replace set fields, add to an array index or to
+// "-" inserts or appends, remove unsets fields and test adds a condition
+// comparing the whole value exactly, so that nothing is changed if one
+// fails and ErrNotFound is returned. Values are extended JSON, e.g.
+// {"$oid": "..."}.
+//
+// A single update can't express everything a patch can, so the patch fails
+// with ErrInvalidQuery for move, copy, removal of array elements, operations
+// on overlapping paths, tests of paths changed earlier in the patch and
+// tests of array elements. A numeric last element of an add path is always
+// taken as an array index, add to a field named e.g. "0" of an object isn't
+// possible
+func (db *DB) ApplyJSONPatch(coll string, id interface{}, patch []byte) (*ChangeInfo, error) {
+	var query, update, err = translatePatch(id, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var o = &Op{Name: "update", Collection: coll, Query: query}
+
+	return db.update(o, true, idempotent(update), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateOne(ctx, query, update,
+			&options.UpdateOptions{Comment: commentValue(ctx)})
+	})
+}
+
+// translatePatch returns the query and update applying patch to the
+// document with id
+func translatePatch(id interface{}, patch []byte) (bson.D, bson.D, error) {
+	var ops []patchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed patch: %v", ErrInvalidQuery, err)
+	}
+
+	var (
+		query   = bson.D{{Key: "_id", Value: id}}
+		tests   = bson.A{}
+		set     = bson.D{}
+		unset   = bson.D{}
+		push    = bson.D{}
+		appends = map[string]int{}
+		paths   []string
+	)
+
+	// changed fails if path overlaps with one changed before
+	var changed = func(path string) error {
+		for _, p := range paths {
+			if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+				return fmt.Errorf("%s overlaps with %s changed before", path, p)
+			}
+		}
+
+		return nil
+	}
+
+	var claim = func(path string) error {
+		if err := changed(path); err != nil {
+			return err
+		}
+
+		paths = append(paths, path)
+
+		return nil
+	}
+
+	for i, op := range ops {
+		var err = func() error {
+			var elems, err = pointer(op.Path)
+			if err != nil {
+				return err
+			}
+
+			var (
+				path  = strings.Join(elems, ".")
+				last  = elems[len(elems)-1]
+				array = strings.Join(elems[:len(elems)-1], ".")
+				index = arrayIndex(last)
+			)
+
+			switch op.Op {
+			case "add", "replace":
+				var v, err = patchValue(op.Value)
+				if err != nil {
+					return err
+				}
+
+				switch {
+				case op.Op == "add" && last == "-" && array != "":
+					if n, ok := appends[array]; ok {
+						var each = push[n].Value.(bson.D)
+						each[0].Value = append(each[0].Value.([]interface{}), v)
+						return nil
+					}
+
+					if err = claim(array); err != nil {
+						return err
+					}
+
+					appends[array] = len(push)
+					push = append(push, bson.E{Key: array, Value: bson.D{{Key: "$each", Value: []interface{}{v}}}})
+				case op.Op == "add" && index >= 0 && array != "":
+					if err = claim(array); err != nil {
+						return err
+					}
+
+					push = append(push, bson.E{Key: array, Value: bson.D{
+						{Key: "$each", Value: []interface{}{v}},
+						{Key: "$position", Value: index},
+					}})
+				case last == "-":
+					return fmt.Errorf("%s can't be replaced", op.Path)
+				default:
+					if err = claim(path); err != nil {
+						return err
+					}
+
+					set = append(set, bson.E{Key: path, Value: v})
+				}
+			case "remove":
+				if index >= 0 || last == "-" {
+					return fmt.Errorf("array elements can't be removed")
+				}
+
+				if err = claim(path); err != nil {
+					return err
+				}
+
+				unset = append(unset, bson.E{Key: path, Value: ""})
+			case "test":
+				var v, err = patchValue(op.Value)
+				if err != nil {
+					return err
+				}
+
+				// the filter sees the document before the update
+				if err = changed(path); err != nil {
+					return err
+				}
+
+				// "$tags.0" would be field 0 of each element of tags
+				for _, elem := range elems {
+					if arrayIndex(elem) >= 0 || elem == "-" {
+						return fmt.Errorf("array elements can't be tested")
+					}
+				}
+
+				// unlike a query an expression neither matches array
+				// elements nor takes a missing field for null. $literal
+				// keeps values like "$x" from becoming field paths
+				tests = append(tests, bson.M{"$eq": bson.A{"$" + path, bson.M{"$literal": v}}})
+
+				if v == nil {
+					query = append(query, bson.E{Key: path, Value: bson.M{"$exists": true}})
+				}
+			default:
+				return fmt.Errorf("op %q not supported", op.Op)
+			}
+
+			return nil
+		}()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidQuery, i, err)
+		}
+	}
+
+	switch len(tests) {
+	case 0:
+	case 1:
+		query = append(query, bson.E{Key: "$expr", Value: tests[0]})
+	default:
+		query = append(query, bson.E{Key: "$expr", Value: bson.M{"$and": tests}})
+	}
+
+	var update = bson.D{}
+
+	for _, e := range []bson.E{{Key: "$set", Value: set}, {Key: "$unset", Value: unset}, {Key: "$push", Value: push}} {
+		if len(e.Value.(bson.D)) > 0 {
+			update = append(update, e)
+		}
+	}
+
+	if len(update) == 0 {
+		return nil, nil, fmt.Errorf("%w: patch changes nothing", ErrInvalidQuery)
+	}
+
+	return query, update, nil
+}
+
+// pointer returns the elements of a JSON pointer, e.g. "/radio/band", which
+// must be fields or array indexes
+func pointer(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("path %q doesn't start with /", s)
+	}
+
+	var elems = strings.Split(s[1:], "/")
+
+	for i, elem := range elems {
+		elem = strings.ReplaceAll(strings.ReplaceAll(elem, "~1", "/"), "~0", "~")
+
+		if elem == "" || strings.HasPrefix(elem, "$") || strings.Contains(elem, ".") {
+			return nil, fmt.Errorf("path %q has an invalid element %q", s, elem)
+		}
+
+		elems[i] = elem
+	}
+
+	return elems, nil
+}
+
+// arrayIndex returns elem as an array index, or -1 if it isn't one
+func arrayIndex(elem string) int {
+	var n, err = strconv.Atoi(elem)
+	if err != nil || n < 0 || strconv.Itoa(n) != elem {
+		return -1
+	}
+
+	return n
+}
+
+// patchValue decodes a value of a patch as relaxed extended JSON, so that
+// integers don't become doubles
+func patchValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("value missing")
+	}
+
+	var doc struct {
+		V interface{} `bson:"v"`
+	}
+
+	var data = append(append([]byte(`{"v":`), raw...), '}')
+
+	if err := bson.UnmarshalExtJSON(data, false, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.V, nil
+}
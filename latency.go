@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latency buckets grow by 20% from 50µs, the last one takes everything
+// above about 5 minutes
+const (
+	latencyMin     = 50 * time.Microsecond
+	latencyGrowth  = 1.2
+	latencyBuckets = 90
+)
+
+// LatencyStats are the latency percentiles of an operation on a collection
+// since the connection was established. Percentiles are bucket bounds, they
+// overestimate by up to 20%
+type LatencyStats struct {
+	Collection string
+	Operation  string
+	Count      int64
+
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// latencies holds a histogram per collection and operation, shared by all
+// handles of a connection
+type latencies struct {
+	m sync.Map
+}
+
+type latencyKey struct {
+	coll, op string
+}
+
+type histogram struct {
+	buckets [latencyBuckets]int64
+}
+
+func (l *latencies) observe(o *Op, d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	var key = latencyKey{o.Collection, o.Name}
+
+	h, ok := l.m.Load(key)
+	if !ok {
+		h, _ = l.m.LoadOrStore(key, &histogram{})
+	}
+
+	atomic.AddInt64(&h.(*histogram).buckets[bucket(d)], 1)
+}
+
+func bucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+
+	var i = int(math.Ceil(math.Log(float64(d)/float64(latencyMin)) / math.Log(latencyGrowth)))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+
+	return i
+}
+
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Pow(latencyGrowth, float64(i)))
+}
+
+func (h *histogram) stats() LatencyStats {
+	var (
+		counts [latencyBuckets]int64
+		s      LatencyStats
+	)
+
+	for i := range h.buckets {
+		counts[i] = atomic.LoadInt64(&h.buckets[i])
+		s.Count += counts[i]
+	}
+
+	var percentile = func(p float64) time.Duration {
+		var rank, seen = int64(math.Ceil(p * float64(s.Count))), int64(0)
+
+		for i, n := range counts {
+			if seen += n; seen >= rank {
+				return bucketBound(i)
+			}
+		}
+
+		return bucketBound(latencyBuckets - 1)
+	}
+
+	if s.Count > 0 {
+		s.P50, s.P95, s.P99 = percentile(0.5), percentile(0.95), percentile(0.99)
+	}
+
+	return s
+}
+
+// LatencyReport returns the latency percentiles of every operation type per
+// collection, e.g. to find the collection that regressed after a deploy.
+// The report is sorted by collection and operation, retries are counted as
+// separate operations
+func (db *DB) LatencyReport() []LatencyStats {
+	var report = []LatencyStats{}
+
+	if db.latency == nil {
+		return report
+	}
+
+	db.latency.m.Range(func(k, h interface{}) bool {
+		var s = h.(*histogram).stats()
+
+		s.Collection, s.Operation = k.(latencyKey).coll, k.(latencyKey).op
+		report = append(report, s)
+
+		return true
+	})
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Collection != report[j].Collection {
+			return report[i].Collection < report[j].Collection
+		}
+
+		return report[i].Operation < report[j].Operation
+	})
+
+	return report
+}
@@ -1,27 +1,70 @@
 package mongo
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	defaultConTimeout = 15 * time.Second
 	defaultMaxTimeMS  = 30 * time.Second
-	errorNotConnected = "DB is not connected"
-	errorNotValid     = "Query is not valid"
+	defaultDatabase   = "test"
 )
 
 // DB for database
 type DB struct {
 	sync.RWMutex
 
-	sess      *mgo.Session
-	maxTimeMS time.Duration
+	link       *link
+	clientOpts []*options.ClientOptions
+	database   string
+	timeout    time.Duration
+	maxTimeMS  time.Duration
+	maxTimeSet bool
+	collTimes  *collMaxTimes
+	lazy       bool
+	hooks      *hooks
+	ops        *inflight
+
+	readRetry  *RetryPolicy
+	writeRetry *RetryPolicy
+	breaker    *breaker
+	limits     *writeLimits
+	metrics    *Metrics
+	collScans  *collScans
+	latency    *latencies
+	queries    *queryStats
+	vars       *expvars
+	slowOp     time.Duration
+	tracer     trace.Tracer
+	sanitize   bool
+	optErr     error
+
+	dialRetry     time.Duration
+	fallbacks     []string
+	probeInterval time.Duration
+
+	readPref     *readpref.ReadPref
+	readConcern  *readconcern.ReadConcern
+	writeConcern *writeconcern.WriteConcern
+
+	// ctx is the parent of every operation context, set on handles that
+	// are bound to a session
+	ctx context.Context
 }
 
 // M for bson.M object
@@ -30,489 +73,1225 @@ type M = bson.M
 // D for bson.D object
 type D = bson.D
 
-func NewConnection(dsn string) (*DB, error) {
+func NewConnection(dsn string, opts ...Option) (*DB, error) {
 	var db = DB{
+		timeout:   defaultConTimeout,
 		maxTimeMS: defaultMaxTimeMS,
 	}
-	return &db, db.Connect(dsn)
+
+	for _, opt := range opts {
+		opt(&db)
+	}
+
+	if db.optErr != nil {
+		return &db, db.optErr
+	}
+
+	return &db, db.ConnectWithTimeout(dsn, db.timeout)
 }
 
 func NewConnectionWithTimeout(dsn string, timeout time.Duration) (*DB, error) {
-	var db = DB{
-		maxTimeMS: defaultMaxTimeMS,
-	}
-	return &db, db.ConnectWithTimeout(dsn, timeout)
+	return NewConnection(dsn, WithTimeout(timeout))
 }
 
 func GetDb() *DB { return &DB{} }
 
 func (db *DB) IsConnected() bool {
-	return db.sess != nil
+	return db.link.current() != nil
 }
 
-func (db *DB) Connect(dsn string) error {
-	var err error
+// mongoClient returns the client in use, nil if not connected
+func (db *DB) mongoClient() *mongo.Client {
+	if c := db.link.current(); c != nil {
+		return c.client
+	}
 
-	db.sess, err = mgo.DialWithTimeout(dsn, defaultConTimeout)
+	return nil
+}
 
-	return err
+func (db *DB) Connect(dsn string) error {
+	return db.ConnectWithTimeout(dsn, defaultConTimeout)
 }
 
 func (db *DB) ConnectWithTimeout(dsn string, timeout time.Duration) error {
-	var err error
-
 	if timeout < time.Second {
 		timeout = defaultConTimeout
 	}
 
-	db.sess, err = mgo.DialWithTimeout(dsn, timeout)
+	var (
+		deadline = time.Now().Add(db.dialRetry)
+		backoff  = RetryPolicy{Backoff: minProbeBackoff, MaxBackoff: maxProbeBackoff}
+	)
 
-	return err
+	for retry := 1; ; retry++ {
+		var err = db.connect(dsn, timeout)
+		if err == nil || !IsTransient(err) {
+			return err
+		}
+
+		var wait = backoff.backoff(retry)
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		db.logger().Warnf("mongo: dial failed, retrying in %v: %v", wait, err)
+
+		if serr := sleep(db.parent(), wait); serr != nil {
+			return fmt.Errorf("%w, dial abandoned: %v", serr, err)
+		}
+	}
 }
 
-func (db *DB) SetMaxTimeMS(d time.Duration) {
-	db.RWMutex.Lock()
-	db.maxTimeMS = d
-	db.RWMutex.Unlock()
+func (db *DB) connect(dsn string, timeout time.Duration) error {
+	if len(db.fallbacks) > 0 {
+		return db.dialFailover(dsn, timeout)
+	}
+
+	return redactError(db.dial(dsn, timeout), dsn)
 }
 
-func (db *DB) Disconnect() {
-	if db.IsConnected() {
-		db.sess.Close()
+// Reconnect connects to dsn, e.g. with rotated credentials or in another
+// data center, and replaces the connection of db and its handles once the
+// deployment answered. Operations running meanwhile finish on the old
+// connection, which is closed afterwards. On error the old connection stays
+// in use. Failover probing of WithFallback stops for a dsn outside of the
+// fallback clusters
+func (db *DB) Reconnect(dsn string) error {
+	db.RWMutex.RLock()
+	var timeout = db.timeout
+	db.RWMutex.RUnlock()
+
+	if timeout < time.Second {
+		timeout = defaultConTimeout
+	}
+
+	var c, err = db.open(dsn, timeout, true)
+	if err != nil {
+		return redactError(err, dsn)
 	}
+
+	db.logger().Debugf("mongo: reconnecting to %s", RedactDSN(dsn))
+	db.use(c, timeout)
+
+	return nil
 }
 
-func (db *DB) CreateIndexKey(coll string, key ...string) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// dial connects to dsn and pings the deployment, so that a returned nil
+// error means the server was reachable, as it did with mgo. In lazy mode
+// the ping is skipped and the driver connects in the background.
+func (db *DB) dial(dsn string, timeout time.Duration) error {
+	var c, err = db.open(dsn, timeout, !db.lazy)
+	if err != nil {
+		return err
 	}
 
-	var sess = db.sess.Copy()
-	defer sess.Close()
+	db.use(c, timeout)
 
-	return sess.DB("").C(coll).EnsureIndexKey(key...)
+	return nil
 }
 
-func (db *DB) CreateIndexKeys(coll string, keys ...string) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// open creates a client for dsn with its own monitor, with ping set it is
+// only returned if the deployment answered
+func (db *DB) open(dsn string, timeout time.Duration, ping bool) (*conn, error) {
+	var cs, err = connstring.ParseAndValidate(dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		err  error
-		sess = db.sess.Copy()
-	)
+	var ctx, cancel = context.WithTimeout(context.Background(), timeout)
 
-	defer sess.Close()
+	defer cancel()
 
-	for _, key := range keys {
-		err = sess.DB("").C(coll).EnsureIndexKey(key)
-		if err != nil {
-			return err
+	var opts = options.Client().
+		ApplyURI(dsn).
+		SetConnectTimeout(timeout).
+		SetServerSelectionTimeout(timeout)
+
+	var c = &conn{
+		dsn:      dsn,
+		database: cs.Database,
+		monitor:  newMonitor(db.callbacks()),
+		pool:     &poolStats{},
+	}
+
+	var monitorOpts = options.Client().
+		SetServerMonitor(c.monitor.serverMonitor(func() *mongo.Client {
+			return c.client
+		})).
+		SetPoolMonitor(c.pool.poolMonitor(db.poolMonitor()))
+
+	var clientOpts = append([]*options.ClientOptions{opts}, db.clientOpts...)
+
+	for _, opts := range clientOpts {
+		if opts.AppName != nil {
+			c.appName = *opts.AppName
 		}
 	}
 
-	return nil
+	client, err := mongo.Connect(ctx, append(clientOpts, monitorOpts)...)
+	if err != nil {
+		c.monitor.close()
+		return nil, err
+	}
+
+	c.client = client
+
+	if ping {
+		if err = client.Ping(ctx, nil); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
-func (db *DB) Insert(coll string, v ...interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// use makes c the connection of db and its handles. A previous connection
+// is closed once the operations running on it finished, when there is none
+// db starts over and handles of an earlier connection stay disconnected
+func (db *DB) use(c *conn, timeout time.Duration) {
+	db.RWMutex.Lock()
+	if db.database == "" {
+		db.database = c.database
+	}
+	if db.database == "" {
+		db.database = defaultDatabase
 	}
 
-	var sess = db.sess.Copy()
+	var fresh = db.link.current() == nil
+	if fresh {
+		db.link = &link{}
+		db.ops = &inflight{}
+		db.latency = &latencies{}
+	}
 
-	defer sess.Close()
+	db.timeout = timeout
+	db.RWMutex.Unlock()
 
-	return sess.DB("").C(coll).Insert(v...)
+	if old := db.link.swap(c); old != nil {
+		go old.closeIdle()
+	}
+
+	c.monitor.activate()
 }
 
-func (db *DB) InsertBulk(coll string, v ...interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
-	}
+// UseDatabase switches the database used by all following operations, by
+// default it is the one named in the DSN or "test"
+func (db *DB) UseDatabase(name string) {
+	db.RWMutex.Lock()
+	db.database = name
+	db.RWMutex.Unlock()
+}
 
-	var sess = db.sess.Copy()
+// DatabaseName returns the name of the database operations run against
+func (db *DB) DatabaseName() string {
+	db.RWMutex.RLock()
+	defer db.RWMutex.RUnlock()
 
-	defer sess.Close()
+	return db.database
+}
 
-	var (
-		err  error
-		bulk = sess.DB("").C(coll).Bulk()
-	)
+// Database returns a handle for the database name sharing the connection
+// and settings of db, e.g. db.Database("analytics").Pipe(...). Don't
+// Disconnect a handle, it closes the shared connection
+func (db *DB) Database(name string) *DB {
+	var handle = db.derive()
 
-	bulk.Unordered()
-	bulk.Insert(v...)
-	_, err = bulk.Run()
+	handle.database = name
 
-	return err
+	return handle
 }
 
-func (db *DB) InsertSess(coll string, sess *mgo.Session,
-	v ...interface{}) error {
-	if !db.IsConnected() || sess == nil {
-		return fmt.Errorf("%s", errorNotConnected)
+// WithReadPreference returns a handle sharing the connection of db whose
+// operations read according to rp, e.g. readpref.SecondaryPreferred()
+func (db *DB) WithReadPreference(rp *readpref.ReadPref) *DB {
+	var handle = db.derive()
+
+	handle.readPref = rp
+
+	return handle
+}
+
+// Eventual returns a handle reading from secondaries when available, like
+// mgo's Eventual mode. Reads may return stale data, writes still go to the
+// primary, e.g. db.Eventual().Pipe("stats", pipeline, &report)
+func (db *DB) Eventual() *DB {
+	return db.WithReadPreference(readpref.SecondaryPreferred())
+}
+
+// EventualWithMaxStaleness is Eventual but skips secondaries lagging more
+// than d behind the primary. The server requires d to be at least 90
+// seconds, smaller values make every read fail
+func (db *DB) EventualWithMaxStaleness(d time.Duration) *DB {
+	return db.WithReadPreference(readpref.SecondaryPreferred(readpref.WithMaxStaleness(d)))
+}
+
+// WithContext returns a handle whose operations derive their context from
+// ctx, so they are canceled with it and traced as its children, e.g.
+// db.WithContext(r.Context()).FindByID(...). A session or transaction of db
+// is kept
+func (db *DB) WithContext(ctx context.Context) *DB {
+	var handle = db.derive()
+
+	if db.ctx != nil {
+		if sess := mongo.SessionFromContext(db.ctx); sess != nil {
+			ctx = mongo.NewSessionContext(ctx, sess)
+		}
+
+		if db.inTransaction() {
+			ctx = context.WithValue(ctx, txKey{}, true)
+		}
 	}
 
-	return sess.DB("").C(coll).Insert(v...)
+	handle.ctx = ctx
+
+	return handle
 }
 
-func (db *DB) Find(coll string, query map[string]interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) mongoDatabase(client *mongo.Client) *mongo.Database {
+	var opts = options.Database()
+	if db.readPref != nil {
+		opts.SetReadPreference(db.readPref)
 	}
 
-	var sess = db.sess.Copy()
+	if db.readConcern != nil {
+		opts.SetReadConcern(db.readConcern)
+	}
 
-	defer sess.Close()
+	if db.writeConcern != nil {
+		opts.SetWriteConcern(db.writeConcern)
+	}
 
-	var bsonQuery = bson.M{}
+	return client.Database(db.DatabaseName(), opts)
+}
 
-	for k, qv := range query {
-		bsonQuery[k] = qv
+func (db *DB) SetMaxTimeMS(d time.Duration) {
+	db.RWMutex.Lock()
+	db.maxTimeMS = d
+	db.RWMutex.Unlock()
+}
+
+// WithMaxTime returns a handle sharing the connection of db whose
+// operations use d instead of the max time of db, e.g. for a nightly
+// export db.WithMaxTime(5*time.Minute).FindAll("events", &events)
+func (db *DB) WithMaxTime(d time.Duration) *DB {
+	var handle = db.derive()
+
+	handle.maxTimeMS = d
+	handle.maxTimeSet = true
+
+	return handle
+}
+
+// SetCollectionMaxTime sets the max time of operations on coll, it applies
+// instead of the one of db except for handles returned by WithMaxTime.
+// A zero duration removes the override
+func (db *DB) SetCollectionMaxTime(coll string, d time.Duration) {
+	var times = db.collectionTimes()
+
+	times.Lock()
+	if d == 0 {
+		delete(times.m, coll)
+	} else {
+		times.m[coll] = d
 	}
+	times.Unlock()
+}
 
-	return sess.DB("").C(coll).Find(bsonQuery).SetMaxTime(db.maxTimeMS).All(v)
+// collMaxTimes holds the max time overrides per collection, shared by all
+// handles of a connection
+type collMaxTimes struct {
+	sync.RWMutex
+
+	m map[string]time.Duration
 }
 
-func (db *DB) Pipe(coll string, query []bson.M, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) collectionTimes() *collMaxTimes {
+	db.RWMutex.Lock()
+	defer db.RWMutex.Unlock()
+
+	if db.collTimes == nil {
+		db.collTimes = &collMaxTimes{m: map[string]time.Duration{}}
 	}
 
-	var sess = db.sess.Copy()
+	return db.collTimes
+}
+
+// maxTime of operations on coll
+func (db *DB) maxTime(coll string) time.Duration {
+	db.RWMutex.RLock()
+	var d, explicit, times = db.maxTimeMS, db.maxTimeSet, db.collTimes
+	db.RWMutex.RUnlock()
 
-	defer sess.Close()
+	if !explicit && times != nil {
+		times.RLock()
+		defer times.RUnlock()
+
+		if cd, ok := times.m[coll]; ok {
+			return cd
+		}
+	}
 
-	return sess.DB("").C(coll).Pipe(query).AllowDiskUse().SetMaxTime(db.maxTimeMS).All(v)
+	return d
 }
 
-func (db *DB) PipeOne(coll string, query []bson.M, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// context bounds a single operation on coll. maxTimeMS is enforced by the
+// server, the connection timeout on top of it covers a stalled network.
+func (db *DB) context(coll string) (context.Context, context.CancelFunc) {
+	var parent = db.parent()
+
+	var d = db.maxTime(coll) + db.timeout
+	if d <= 0 {
+		return context.WithCancel(parent)
 	}
 
-	var sess = db.sess.Copy()
+	return context.WithTimeout(parent, d)
+}
 
-	defer sess.Close()
+// parent returns the context operations of db derive from
+func (db *DB) parent() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
 
-	return sess.DB("").C(coll).Pipe(query).AllowDiskUse().SetMaxTime(db.maxTimeMS).One(v)
+	return db.ctx
 }
 
-func (db *DB) FindByID(coll string, id string, v interface{}) bool {
-	if !db.IsConnected() {
-		return false
+// derive returns a handle sharing the connection and settings of db
+func (db *DB) derive() *DB {
+	var times = db.collectionTimes()
+
+	db.RWMutex.RLock()
+	defer db.RWMutex.RUnlock()
+
+	return &DB{
+		link:       db.link,
+		clientOpts: db.clientOpts,
+		database:   db.database,
+		timeout:    db.timeout,
+		maxTimeMS:  db.maxTimeMS,
+		maxTimeSet: db.maxTimeSet,
+		collTimes:  times,
+		readPref:   db.readPref,
+
+		readConcern:  db.readConcern,
+		writeConcern: db.writeConcern,
+		ctx:          db.ctx,
+		hooks:        db.hooks,
+		ops:          db.ops,
+		readRetry:    db.readRetry,
+		writeRetry:   db.writeRetry,
+		breaker:      db.breaker,
+		limits:       db.limits,
+		metrics:      db.metrics,
+		collScans:    db.collScans,
+		latency:      db.latency,
+		queries:      db.queries,
+		vars:         db.vars,
+		slowOp:       db.slowOp,
+		tracer:       db.tracer,
+		sanitize:     db.sanitize,
 	}
+}
 
-	var sess = db.sess.Copy()
+// exec runs fn against the named collection of the current database,
+// errors of the driver are wrapped with the collection name if there is one.
+func (db *DB) exec(o *Op, fn func(context.Context, *mongo.Collection) error) error {
+	if err := db.limits.wait(db.parent(), o); err != nil {
+		return err
+	}
 
-	defer sess.Close()
+	var c = db.link.acquire()
+	if c == nil {
+		return ErrNotConnected
+	}
 
-	return mgo.ErrNotFound != sess.DB("").C(coll).FindId(id).SetMaxTime(db.maxTimeMS).One(v)
-}
+	defer c.users.Done()
 
-func (db *DB) FindAll(coll string, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+	if !db.ops.enter() {
+		return ErrShutdown
 	}
 
-	var sess = db.sess.Copy()
+	defer db.ops.leave()
 
-	defer sess.Close()
+	var ok, probe = db.breaker.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
 
-	return sess.DB("").C(coll).Find(bson.M{}).SetMaxTime(db.maxTimeMS).All(v)
-}
+	// err stays errAborted if middleware panics, so that a probe doesn't
+	// stay in flight forever
+	var err = errAborted
 
-func (db *DB) FindWithQuery(coll string, query interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+	defer func() { db.breaker.done(probe, err, db.logger()) }()
+
+	var ctx, cancel = db.context(o.Collection)
+
+	defer cancel()
+
+	ctx, span := db.startSpan(ctx, o)
+
+	var run = func(ctx context.Context, o *Op) error {
+		return fn(ctx, db.mongoDatabase(c.client).Collection(o.Collection))
 	}
 
-	var sess = db.sess.Copy()
+	var start = time.Now()
+
+	err = db.hooks.chain(run)(ctx, o)
+
+	var took = time.Since(start)
+
+	endSpan(span, o, err)
+	db.observe(o, took, err)
+
+	switch {
+	case err == nil:
+		db.hooks.audit(ctx, o)
+	case o.Collection != "":
+		return fmt.Errorf("%s: %w", o.Collection, err)
+	}
 
-	defer sess.Close()
+	return err
+}
 
-	return sess.DB("").C(coll).Find(query).SetMaxTime(db.maxTimeMS).One(v)
+// observe reports a finished operation to the instrumentation of db
+func (db *DB) observe(o *Op, took time.Duration, err error) {
+	db.metrics.observe(o, took, err)
+	db.vars.observe(o, err)
+	db.latency.observe(o, took)
+	db.queries.observe(o, took, err)
+	db.logFailure(o, err)
+	db.logSlow(o, took)
+	db.logDebug(o, took, err)
 }
 
-func (db *DB) FindWithQuerySortOne(coll string, query interface{},
-	order string, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// Disconnect closes the connection right away, see Shutdown to let running
+// operations finish first
+func (db *DB) Disconnect() {
+	if c := db.link.swap(nil); c != nil {
+		c.close()
 	}
+}
 
-	var sess = db.sess.Copy()
+func (db *DB) CreateIndexKey(coll string, key ...string) error {
+	return db.exec(&Op{Name: "createIndex", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		var _, err = c.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: indexKeys(key...)})
 
-	defer sess.Close()
+		return err
+	})
+}
+
+func (db *DB) CreateIndexKeys(coll string, keys ...string) error {
+	return db.exec(&Op{Name: "createIndex", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		for _, key := range keys {
+			var _, err = c.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: indexKeys(key)})
+			if err != nil {
+				return err
+			}
+		}
 
-	return sess.DB("").C(coll).Find(query).Sort(order).SetMaxTime(db.maxTimeMS).One(v)
+		return nil
+	})
 }
 
-func (db *DB) FindWithQuerySortAll(coll string, query interface{},
-	order string, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
-	}
+func (db *DB) Insert(coll string, v ...interface{}) error {
+	var o = &Op{Name: "insert", Collection: coll, N: len(v)}
 
-	var sess = db.sess.Copy()
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = c.InsertMany(ctx, v, &options.InsertManyOptions{Comment: commentValue(ctx)})
+		if err != nil {
+			return err
+		}
 
-	defer sess.Close()
+		o.IDs = res.InsertedIDs
 
-	return sess.DB("").C(coll).Find(query).Sort(order).SetMaxTime(db.maxTimeMS).All(v)
+		return nil
+	})
 }
 
-func (db *DB) FindWithQuerySortLimitAll(coll string, query interface{},
-	order string, limit int, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// InsertBulk inserts v unordered, so that a failing document doesn't stop
+// the others. v is split into batches of up to 1000 documents and 16MB,
+// each one is reported to metrics and middleware as an insert of its own.
+// The errors of all batches are joined
+func (db *DB) InsertBulk(coll string, v ...interface{}) error {
+	var batches, err = splitBatches(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
 	}
 
-	var sess = db.sess.Copy()
+	var errs []error
+
+	for _, batch := range batches {
+		var o = &Op{Name: "insert", Collection: coll, N: len(batch)}
+
+		err = db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+			var res, err = c.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false).SetComment(commentValue(ctx)))
+			if res != nil {
+				o.IDs = res.InsertedIDs
+			}
+
+			return err
+		})
+
+		var bwe mongo.BulkWriteException
 
-	defer sess.Close()
+		switch {
+		case err == nil:
+		case errors.As(err, &bwe):
+			errs = append(errs, err)
+		default:
+			// the remaining batches would fail the same way
+			return errors.Join(append(errs, err)...)
+		}
+	}
 
-	return sess.DB("").C(coll).Find(query).Sort(order).Limit(limit).SetMaxTime(db.maxTimeMS).All(v)
+	return errors.Join(errs...)
 }
 
-func (db *DB) FindWithQueryOne(coll string, query interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) InsertSess(coll string, sess mongo.Session,
+	v ...interface{}) error {
+	if sess == nil {
+		return ErrNotConnected
 	}
 
-	var sess = db.sess.Copy()
+	var o = &Op{Name: "insert", Collection: coll, N: len(v)}
 
-	defer sess.Close()
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = c.InsertMany(mongo.NewSessionContext(ctx, sess), v,
+			&options.InsertManyOptions{Comment: commentValue(ctx)})
+		if err != nil {
+			return err
+		}
+
+		o.IDs = res.InsertedIDs
 
-	return sess.DB("").C(coll).Find(query).SetMaxTime(db.maxTimeMS).One(v)
+		return nil
+	})
 }
 
-func (db *DB) FindWithQueryAll(coll string, query interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// Find returns all documents matching query, e.g. a map, a bson.D or a
+// *Query. It is checked with SanitizeFilter first if the DB was opened
+// WithFilterSanitizing
+func (db *DB) Find(coll string, query interface{}, v interface{}) error {
+	if db.sanitize {
+		var err error
+		if query, err = sanitizeQuery(query); err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
 	}
 
-	var sess = db.sess.Copy()
+	return db.findAll(coll, filter(query), options.Find(), v)
+}
 
-	defer sess.Close()
+// Pipe runs the aggregation query, e.g. a []bson.M or a mongo.Pipeline of
+// ordered stages, and decodes all results into v
+func (db *DB) Pipe(coll string, query interface{}, v interface{}) error {
+	return db.pipeAll(coll, query, options.Aggregate(), v)
+}
 
-	return sess.DB("").C(coll).Find(query).SetMaxTime(db.maxTimeMS).All(v)
+func (db *DB) PipeOne(coll string, query interface{}, v interface{}) error {
+	return db.pipeOne(coll, query, options.Aggregate(), v)
 }
 
-func (db *DB) FindWithQuerySortLimitOffsetAll(coll string, query interface{}, sort string,
-	limit int, offset int, v interface{}) error {
+func (db *DB) FindByID(coll string, id string, v interface{}) bool {
 	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+		return false
 	}
 
-	var sess = db.sess.Copy()
+	var err = db.findOne(coll, bson.M{"_id": id}, options.FindOne(), v)
+
+	return !errors.Is(err, ErrNotFound)
+}
 
-	defer sess.Close()
+func (db *DB) FindAll(coll string, v interface{}) error {
+	return db.findAll(coll, bson.M{}, options.Find(), v)
+}
 
-	return sess.DB("").C(coll).Find(query).Sort(sort).Limit(limit).Skip(offset).SetMaxTime(db.maxTimeMS).All(v)
+func (db *DB) FindWithQuery(coll string, query interface{}, v interface{}) error {
+	return db.findOne(coll, query, options.FindOne(), v)
 }
 
+// Deprecated: use FindOneWithOptions
+func (db *DB) FindWithQuerySortOne(coll string, query interface{},
+	order string, v interface{}) error {
+	return db.findOne(coll, query, options.FindOne().SetSort(sortFields(order)), v)
+}
+
+// Deprecated: use FindWithOptions
+func (db *DB) FindWithQuerySortAll(coll string, query interface{},
+	order string, v interface{}) error {
+	return db.findAll(coll, query, options.Find().SetSort(sortFields(order)), v)
+}
+
+// Deprecated: use FindWithOptions
+func (db *DB) FindWithQuerySortLimitAll(coll string, query interface{},
+	order string, limit int, v interface{}) error {
+	var opts = options.Find().
+		SetSort(sortFields(order)).
+		SetLimit(int64(limit))
+
+	return db.findAll(coll, query, opts, v)
+}
+
+func (db *DB) FindWithQueryOne(coll string, query interface{}, v interface{}) error {
+	return db.findOne(coll, query, options.FindOne(), v)
+}
+
+func (db *DB) FindWithQueryAll(coll string, query interface{}, v interface{}) error {
+	return db.findAll(coll, query, options.Find(), v)
+}
+
+// Deprecated: use FindWithOptions
+func (db *DB) FindWithQuerySortLimitOffsetAll(coll string, query interface{}, sort string,
+	limit int, offset int, v interface{}) error {
+	var opts = options.Find().
+		SetSort(sortFields(sort)).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	return db.findAll(coll, query, opts, v)
+}
+
+// FindWithQuerySortLimitOffsetTotalAll is FindWithQuerySortLimitOffsetAll
+// that stores the number of all matching documents in total. With total
+// the page and the count are a single aggregation, see FindPage, and limit
+// must be positive
+//
+// Deprecated: use FindPage
 func (db *DB) FindWithQuerySortLimitOffsetTotalAll(coll string, query interface{},
 	sort string, limit int, offset int, v interface{}, total *int) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+	if total == nil {
+		return db.FindWithQuerySortLimitOffsetAll(coll, query, sort, limit, offset, v)
 	}
 
-	var sess = db.sess.Copy()
-
-	defer sess.Close()
-
-	if total != nil {
-		*total, _ = sess.DB("").C(coll).Find(query).SetMaxTime(db.maxTimeMS).Count()
+	var n, err = db.FindPage(coll, query, sort, limit, offset, v)
+	if err != nil {
+		return err
 	}
 
-	return sess.DB("").C(coll).Find(query).Sort(sort).Limit(limit).Skip(offset).SetMaxTime(db.maxTimeMS).All(v)
+	*total = n
+
+	return nil
 }
 
 func (db *DB) Count(coll string, query interface{}) (int, error) {
-	if !db.IsConnected() {
-		return 0, fmt.Errorf("%s", errorNotConnected)
-	}
+	return db.count(coll, query, options.Count())
+}
 
-	var sess = db.sess.Copy()
+// ChangeInfo describes the outcome of an update or upsert
+type ChangeInfo struct {
+	// Matched is the number of documents matched by the query
+	Matched int
 
-	defer sess.Close()
+	// Updated is the number of documents actually changed
+	Updated int
 
-	return sess.DB("").C(coll).Find(query).SetMaxTime(db.maxTimeMS).Count()
+	// UpsertedID is the _id of the inserted document if an upsert inserted
+	UpsertedID interface{}
 }
 
-func (db *DB) Update(coll string, id interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// Update sets the fields of v in the document with id, or applies v if it
+// is an UpdateBuilder
+func (db *DB) Update(coll string, id interface{}, v interface{}) (*ChangeInfo, error) {
+	var update, err = setUpdate(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
 	}
 
-	var sess = db.sess.Copy()
+	var o = &Op{Name: "update", Collection: coll, Query: bson.M{"_id": id}}
 
-	defer sess.Close()
-
-	return sess.DB("").C(coll).Update(bson.M{"_id": id}, bson.M{"$set": v})
+	return db.update(o, true, idempotent(update), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateOne(ctx, o.Query, update,
+			&options.UpdateOptions{Comment: commentValue(ctx)})
+	})
 }
 
-func (db *DB) UpdateWithQuery(coll string, query interface{}, set interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
-	}
+func (db *DB) UpdateWithQuery(coll string, query interface{}, set interface{}) (*ChangeInfo, error) {
+	var o = &Op{Name: "update", Collection: coll, Query: query}
 
-	var sess = db.sess.Copy()
+	return db.update(o, true, idempotent(set), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return updateOne(ctx, c, query, set, false)
+	})
+}
 
-	defer sess.Close()
+func (db *DB) UpdateWithQueryAll(coll string, query interface{}, set interface{}) (*ChangeInfo, error) {
+	var o = &Op{Name: "update", Collection: coll, Query: query}
 
-	return sess.DB("").C(coll).Update(query, set)
+	return db.update(o, false, idempotent(set), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateMany(ctx, filter(query), set,
+			&options.UpdateOptions{Comment: commentValue(ctx)})
+	})
 }
 
-func (db *DB) UpdateWithQueryAll(coll string, query interface{}, set interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// UpdateWithArrayFilters applies update to the first document matching
+// query, filters select the array elements for the $[<identifier>]
+// positional operators, e.g. update M{"$set": M{"radios.$[r].channel": 6}}
+// with filters []M{{"r.band": "2.4"}}
+func (db *DB) UpdateWithArrayFilters(coll string, query interface{}, update interface{},
+	filters []M) (*ChangeInfo, error) {
+	var arrayFilters = options.ArrayFilters{Filters: make([]interface{}, len(filters))}
+
+	for i, f := range filters {
+		arrayFilters.Filters[i] = f
 	}
 
-	var (
-		err  error
-		sess = db.sess.Copy()
-	)
+	var o = &Op{Name: "update", Collection: coll, Query: query}
+
+	return db.update(o, true, idempotent(update), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateOne(ctx, filter(query), update,
+			options.Update().SetArrayFilters(arrayFilters).SetComment(commentValue(ctx)))
+	})
+}
 
-	defer sess.Close()
+// Replace replaces the document with the given id by doc, fields missing in
+// doc are removed unlike with Update
+func (db *DB) Replace(coll string, id interface{}, doc interface{}) (*ChangeInfo, error) {
+	return db.ReplaceWithQuery(coll, bson.M{"_id": id}, doc)
+}
 
-	_, err = sess.DB("").C(coll).UpdateAll(query, set)
+// ReplaceWithQuery replaces the first document matching query by doc
+func (db *DB) ReplaceWithQuery(coll string, query interface{}, doc interface{}) (*ChangeInfo, error) {
+	var o = &Op{Name: "replace", Collection: coll, Query: query}
 
-	return err
+	return db.update(o, true, true, func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.ReplaceOne(ctx, filter(query), doc,
+			&options.ReplaceOptions{Comment: commentValue(ctx)})
+	})
 }
 
-func (db *DB) Upsert(coll string, id interface{}, v interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
-	}
+func (db *DB) Upsert(coll string, id interface{}, v interface{}) (*ChangeInfo, error) {
+	var o = &Op{Name: "upsert", Collection: coll, Query: bson.M{"_id": id}}
 
-	var sess = db.sess.Copy()
+	return db.update(o, false, idempotent(v), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return updateOne(ctx, c, o.Query, v, true)
+	})
+}
 
-	defer sess.Close()
+func (db *DB) UpsertWithQuery(coll string, query interface{}, set interface{}) (*ChangeInfo, error) {
+	var o = &Op{Name: "upsert", Collection: coll, Query: query}
 
-	var _, err = sess.DB("").C(coll).Upsert(bson.M{"_id": id}, v)
+	return db.update(o, false, idempotent(set), func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return updateOne(ctx, c, query, set, true)
+	})
+}
 
-	return err
+// UpsertWithDefaults sets the fields of set in the first document matching
+// query and inserts one if none matches, with the fields of setOnInsert as
+// well, e.g. created_at, so that they aren't overwritten by later upserts.
+// Either may be nil, a field can't be in both
+func (db *DB) UpsertWithDefaults(coll string, query interface{}, set interface{},
+	setOnInsert interface{}) (*ChangeInfo, error) {
+	var update, err = upsertDefaults(set, setOnInsert)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var o = &Op{Name: "upsert", Collection: coll, Query: query}
+
+	return db.update(o, false, true, func(ctx context.Context, c *mongo.Collection) (*mongo.UpdateResult, error) {
+		return c.UpdateOne(ctx, filter(query), update,
+			options.Update().SetUpsert(true).SetComment(commentValue(ctx)))
+	})
 }
 
-func (db *DB) UpsertWithQuery(coll string, query interface{}, set interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+// upsertDefaults returns the update of UpsertWithDefaults
+func upsertDefaults(set, setOnInsert interface{}) (bson.D, error) {
+	for _, v := range []interface{}{set, setOnInsert} {
+		if _, ok := v.(*UpdateBuilder); ok {
+			return nil, fmt.Errorf("%w: UpdateBuilder passed as fields, use Upsert with SetOnInsert", ErrInvalidQuery)
+		}
 	}
 
-	var sess = db.sess.Copy()
+	var update = bson.D{}
 
-	defer sess.Close()
+	if set != nil {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
 
-	var _, err = sess.DB("").C(coll).Upsert(query, set)
+	if setOnInsert != nil {
+		update = append(update, bson.E{Key: "$setOnInsert", Value: setOnInsert})
+	}
 
-	return err
+	if len(update) == 0 {
+		return nil, fmt.Errorf("%w: nothing to upsert", ErrInvalidQuery)
+	}
+
+	return update, nil
 }
 
+// UpsertMulti upserts v[i] as the document with id[i] in a single unordered
+// bulk write, like Upsert a document without operators replaces the stored
+// one. The error describes the upserts that failed
 func (db *DB) UpsertMulti(coll string, id []interface{}, v []interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+	var models, err = upsertModels(id, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	if len(models) == 0 {
+		return nil
 	}
 
+	var o = &Op{Name: "upsert", Collection: coll, IDs: id}
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false).SetComment(commentValue(ctx)))
+		if res != nil {
+			o.N = int(res.ModifiedCount + res.UpsertedCount)
+		}
+
+		return err
+	})
+}
+
+// upsertModels returns the write models of UpsertMulti
+func upsertModels(id []interface{}, v []interface{}) ([]mongo.WriteModel, error) {
 	if len(id) != len(v) {
-		return fmt.Errorf("%s", errorNotValid)
+		return nil, fmt.Errorf("%w: %d ids for %d documents", ErrInvalidQuery, len(id), len(v))
 	}
 
-	var (
-		index = 0
-		sess  = db.sess.Copy()
-	)
+	var models = make([]mongo.WriteModel, len(id))
 
-	defer sess.Close()
+	for i := range id {
+		var m, _, err = BulkUpsert(bson.M{"_id": id[i]}, v[i]).model()
+		if err != nil {
+			return nil, err
+		}
 
-	for index < len(id) {
-		// TODO: fix errcheck linter issue: return value is not checked
-		sess.DB("").C(coll).Upsert(bson.M{"_id": id[index]}, v[index])
-		index++
+		models[i] = m
 	}
 
-	return nil
+	return models, nil
 }
 
-func (db *DB) Remove(coll string, id interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) Remove(coll string, id interface{}) (int, error) {
+	return db.RemoveWithQuery(coll, bson.M{"_id": id})
+}
+
+func (db *DB) RemoveAll(coll string) (int, error) {
+	return db.RemoveWithQuery(coll, bson.M{})
+}
+
+// RemoveWithQuery removes all documents matching query and returns how many
+// were removed
+func (db *DB) RemoveWithQuery(coll string, query interface{}) (int, error) {
+	var o = &Op{Name: "remove", Collection: coll, Query: query}
+
+	var err = db.write(o, true, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = c.DeleteMany(ctx, filter(query), &options.DeleteOptions{Comment: commentValue(ctx)})
+		if err != nil {
+			return err
+		}
+
+		o.N = int(res.DeletedCount)
+		o.IDs = queryIDs(query)
+
+		return nil
+	})
+
+	return o.N, err
+}
+
+func (db *DB) RemoveWithIDs(coll string, ids interface{}) (int, error) {
+	return db.RemoveWithQuery(coll, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (db *DB) SessExec(cb func(mongo.Session)) {
+	var sess = db.SessCopy()
+	if sess == nil {
+		return
 	}
 
-	var sess = db.sess.Copy()
+	defer db.SessClose(sess)
+
+	cb(sess)
+}
 
-	defer sess.Close()
+func (db *DB) SessCopy() mongo.Session {
+	var client = db.mongoClient()
+	if client == nil {
+		return nil
+	}
 
-	_, err := sess.DB("").C(coll).RemoveAll(bson.M{"_id": id})
+	var sess, err = client.StartSession()
+	if err != nil {
+		return nil
+	}
 
-	return err
+	return sess
+}
+
+func (db *DB) SessClose(sess mongo.Session) {
+	if !db.IsConnected() || sess == nil {
+		return
+	}
+
+	sess.EndSession(context.Background())
 }
 
-func (db *DB) RemoveAll(coll string) error {
-	var sess = db.sess.Copy()
+func (db *DB) findOne(coll string, query interface{},
+	opts *options.FindOneOptions, v interface{}) error {
+	var o = &Op{Name: "findOne", Collection: coll, Query: query, Result: v}
 
-	defer sess.Close()
+	return db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		if err := c.FindOne(ctx, filter(query), opts.SetMaxTime(db.maxTime(coll)),
+			&options.FindOneOptions{Comment: comment(ctx)}).Decode(v); err != nil {
+			return err
+		}
 
-	_, err := sess.DB("").C(coll).RemoveAll(bson.M{})
+		o.N = 1
 
-	return err
+		return nil
+	})
 }
 
-func (db *DB) RemoveWithQuery(coll string, query interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) findAll(coll string, query interface{},
+	opts *options.FindOptions, v interface{}) error {
+	var o = &Op{Name: "find", Collection: coll, Query: query, Result: v}
+
+	return db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Find(ctx, filter(query), opts.SetMaxTime(db.maxTime(coll)),
+			&options.FindOptions{Comment: comment(ctx)})
+		if err != nil {
+			return err
+		}
+
+		if err = cur.All(ctx, v); err != nil {
+			return err
+		}
+
+		o.N = docs(v)
+
+		return nil
+	})
+}
+
+func (db *DB) count(coll string, query interface{},
+	opts *options.CountOptions) (int, error) {
+	var n int64
+
+	var err = db.read(&Op{Name: "count", Collection: coll, Query: query}, func(ctx context.Context, c *mongo.Collection) error {
+		var err error
+
+		// a time limit of opts overrides the default one
+		n, err = c.CountDocuments(ctx, filter(query), options.Count().SetMaxTime(db.maxTime(coll)),
+			opts, &options.CountOptions{Comment: comment(ctx)})
+
+		return err
+	})
+
+	return int(n), err
+}
+
+// update runs fn and reports its outcome, with notFound set a query that
+// matched nothing fails with ErrNotFound like mgo's Update did. Idempotent
+// updates are retried on transient errors, see WithWriteRetries
+func (db *DB) update(o *Op, notFound, retryable bool,
+	fn func(context.Context, *mongo.Collection) (*mongo.UpdateResult, error)) (*ChangeInfo, error) {
+	var info *ChangeInfo
+
+	var err = db.write(o, retryable, func(ctx context.Context, c *mongo.Collection) error {
+		var res, err = fn(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		o.N = int(res.ModifiedCount + res.UpsertedCount)
+		o.IDs = queryIDs(o.Query)
+
+		if res.UpsertedID != nil {
+			o.IDs = []interface{}{res.UpsertedID}
+		}
+
+		info = &ChangeInfo{
+			Matched:    int(res.MatchedCount),
+			Updated:    int(res.ModifiedCount),
+			UpsertedID: res.UpsertedID,
+		}
+
+		if notFound && res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+
+	return info, err
+}
+
+func (db *DB) pipeAll(coll string, query interface{},
+	opts *options.AggregateOptions, v interface{}) error {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
 	}
 
-	var (
-		err  error
-		sess = db.sess.Copy()
-	)
+	var o = &Op{Name: "aggregate", Collection: coll, Query: pipeline, Result: v}
 
-	defer sess.Close()
+	return db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Aggregate(ctx, pipeline, db.pipeOptions(coll, opts),
+			&options.AggregateOptions{Comment: comment(ctx)})
+		if err != nil {
+			return err
+		}
 
-	_, err = sess.DB("").C(coll).RemoveAll(query)
+		if err = cur.All(ctx, v); err != nil {
+			return err
+		}
 
-	return err
+		o.N = docs(v)
+
+		return nil
+	})
 }
 
-func (db *DB) RemoveWithIDs(coll string, ids interface{}) error {
-	if !db.IsConnected() {
-		return fmt.Errorf("%s", errorNotConnected)
+func (db *DB) pipeOne(coll string, query interface{},
+	opts *options.AggregateOptions, v interface{}) error {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
 	}
 
-	var sess = db.sess.Copy()
+	var o = &Op{Name: "aggregate", Collection: coll, Query: pipeline, Result: v}
 
-	defer sess.Close()
+	return db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Aggregate(ctx, pipeline, db.pipeOptions(coll, opts),
+			&options.AggregateOptions{Comment: comment(ctx)})
+		if err != nil {
+			return err
+		}
 
-	_, err := sess.DB("").C(coll).RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		defer cur.Close(ctx)
 
-	return err
+		if !cur.Next(ctx) {
+			if err = cur.Err(); err != nil {
+				return err
+			}
+			return ErrNotFound
+		}
+
+		if err = cur.Decode(v); err != nil {
+			return err
+		}
+
+		o.N = 1
+
+		return nil
+	})
 }
 
-func (db *DB) SessExec(cb func(*mgo.Session)) {
-	if !db.IsConnected() {
-		return
+func (db *DB) pipeOptions(coll string, opts *options.AggregateOptions) *options.AggregateOptions {
+	return opts.
+		SetAllowDiskUse(true).
+		SetMaxTime(db.maxTime(coll))
+}
+
+// docs returns the length of the slice v points to
+func docs(v interface{}) int {
+	var rv = reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice {
+		return 0
 	}
 
-	var sess = db.sess.Copy()
+	return rv.Len()
+}
 
-	defer sess.Close()
+// filter substitutes an empty document for a nil query; mgo treated nil as
+// "match everything" while the driver rejects it.
+func filter(query interface{}) interface{} {
+	if query == nil {
+		return bson.M{}
+	}
 
-	cb(sess)
+	return query
 }
 
-func (db *DB) SessCopy() *mgo.Session {
-	if !db.IsConnected() {
-		return nil
+// updateOne keeps mgo's Update/Upsert semantics: a document starting with
+// an update operator is applied as an update, anything else replaces the
+// matched document.
+func updateOne(ctx context.Context, c *mongo.Collection, query interface{},
+	update interface{}, upsert bool) (*mongo.UpdateResult, error) {
+	var isUpdate, err = hasOperators(update)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUpdate {
+		return c.UpdateOne(ctx, filter(query), update,
+			options.Update().SetUpsert(upsert).SetComment(commentValue(ctx)))
 	}
 
-	return db.sess.Copy()
+	return c.ReplaceOne(ctx, filter(query), update,
+		options.Replace().SetUpsert(upsert).SetComment(commentValue(ctx)))
 }
 
-func (db *DB) SessClose(sess *mgo.Session) {
-	if !db.IsConnected() || sess == nil {
-		return
+func hasOperators(doc interface{}) (bool, error) {
+	var raw, err = bson.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil || len(elems) == 0 {
+		return false, err
+	}
+
+	return strings.HasPrefix(elems[0].Key(), "$"), nil
+}
+
+// sortFields converts mgo-style sort fields ("name", "-created") into an
+// ordered sort document.
+func sortFields(fields ...string) bson.D {
+	var doc = bson.D{}
+
+	for _, field := range fields {
+		var order = 1
+
+		switch {
+		case strings.HasPrefix(field, "-"):
+			order = -1
+			field = field[1:]
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		}
+
+		if field == "" {
+			continue
+		}
+
+		doc = append(doc, bson.E{Key: field, Value: order})
+	}
+
+	return doc
+}
+
+// indexKeys converts mgo-style index keys ("name", "-created",
+// "$text:title", "$2dsphere:loc", "@loc") into an ordered key document.
+func indexKeys(keys ...string) bson.D {
+	var doc = bson.D{}
+
+	for _, key := range keys {
+		var kind interface{} = 1
+
+		switch {
+		case strings.HasPrefix(key, "$"):
+			if i := strings.Index(key, ":"); i > 0 {
+				kind, key = key[1:i], key[i+1:]
+			}
+		case strings.HasPrefix(key, "@"):
+			kind, key = "2d", key[1:]
+		case strings.HasPrefix(key, "-"):
+			kind, key = -1, key[1:]
+		case strings.HasPrefix(key, "+"):
+			key = key[1:]
+		}
+
+		if key == "" {
+			continue
+		}
+
+		doc = append(doc, bson.E{Key: key, Value: kind})
 	}
 
-	sess.Close()
+	return doc
 }
@@ -1,7 +1,24 @@
 package mongo
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestNullDb(t *testing.T) {
@@ -13,4 +30,1949 @@ func TestNullDb(t *testing.T) {
 	if err := db.Insert("test", []string{"1", "2"}); err == nil {
 		t.Fatalf("Insert with empty not working")
 	}
+
+	if err := db.FindAll("test", nil); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("FindAll returned %v, want ErrNotConnected", err)
+	}
+
+	var err = db.ForEach("test", nil, 100, func(bson.Raw) error { return nil })
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("ForEach returned %v, want ErrNotConnected", err)
+	}
+
+	var ch, stop = db.FindChan("test", nil)
+	for range ch {
+		t.Fatal("FindChan sent a document")
+	}
+
+	if err = stop(); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("FindChan stopped with %v, want ErrNotConnected", err)
+	}
+
+	if _, err = db.Increment("test", 1, "$where", 1); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Increment of $where returned %v, want ErrInvalidQuery", err)
+	}
+
+	if _, err = db.Increment("test", 1, "stats.count", 1); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Increment returned %v, want ErrNotConnected", err)
+	}
+}
+
+func TestIndexKeys(t *testing.T) {
+	keys := indexKeys("name", "-created", "$text:title", "@loc")
+	want := D{{Key: "name", Value: 1}, {Key: "created", Value: -1},
+		{Key: "title", Value: "text"}, {Key: "loc", Value: "2d"}}
+
+	if len(keys) != len(want) {
+		t.Fatalf("indexKeys returned %v", keys)
+	}
+
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("indexKeys[%d] = %v, want %v", i, keys[i], want[i])
+		}
+	}
+}
+
+func TestFindOptions(t *testing.T) {
+	var nilOpts *FindOptions
+	if opts := nilOpts.find(); opts.Limit != nil || opts.Sort != nil {
+		t.Fatalf("nil FindOptions set driver options")
+	}
+
+	opts := (&FindOptions{Sort: []string{"-created"}, Limit: 10, Skip: 20}).find()
+	if *opts.Limit != 10 || *opts.Skip != 20 {
+		t.Fatalf("FindOptions limit/skip not applied")
+	}
+
+	if sort := opts.Sort.(D); len(sort) != 1 || sort[0].Key != "created" || sort[0].Value != -1 {
+		t.Fatalf("FindOptions sort = %v", opts.Sort)
+	}
+}
+
+func TestIndexModel(t *testing.T) {
+	model, err := Index{Keys: []string{"created"}, Unique: true, ExpireAfter: time.Hour}.model()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *model.Options.Unique != true || *model.Options.ExpireAfterSeconds != 3600 {
+		t.Fatalf("Index options not applied")
+	}
+
+	if model.Options.Sparse != nil || model.Options.Name != nil {
+		t.Fatalf("Index set unrequested options")
+	}
+
+	if model, _ = (Index{Keys: []string{"expires"}, TTL: true}).model(); model.Options.ExpireAfterSeconds == nil ||
+		*model.Options.ExpireAfterSeconds != 0 {
+		t.Fatalf("TTL index without delay has no expireAfterSeconds")
+	}
+
+	if model, _ = (Index{Keys: []string{"name"}}).model(); model.Options.ExpireAfterSeconds != nil {
+		t.Fatalf("plain index has expireAfterSeconds")
+	}
+
+	for _, bad := range []Index{{}, {Keys: []string{"ts"}, ExpireAfter: 500 * time.Millisecond}, {Keys: []string{"ts"}, ExpireAfter: -time.Second}} {
+		if _, err = bad.model(); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("%+v returned %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+}
+
+func TestNewPolygon(t *testing.T) {
+	polygon := NewPolygon([2]float64{0, 0}, [2]float64{1, 0}, [2]float64{1, 1})
+
+	ring := polygon.Coordinates[0]
+	if len(ring) != 4 || ring[3][0] != 0 || ring[3][1] != 0 {
+		t.Fatalf("NewPolygon didn't close the ring: %v", ring)
+	}
+}
+
+func TestDatabaseHandle(t *testing.T) {
+	db := DB{database: "wimark", maxTimeMS: time.Second}
+
+	analytics := db.Database("analytics")
+	if analytics.DatabaseName() != "analytics" || db.DatabaseName() != "wimark" {
+		t.Fatalf("Database handle changed the parent database")
+	}
+
+	if analytics.maxTime("test") != time.Second {
+		t.Fatalf("Database handle didn't inherit settings")
+	}
+}
+
+func TestReconnectHook(t *testing.T) {
+	var (
+		db          = DB{}
+		connects    = make(chan *DB, 1)
+		disconnects = make(chan struct{}, 1)
+		reconnects  = make(chan time.Duration, 1)
+	)
+
+	WithConnectHook(func(db *DB) { connects <- db })(&db)
+	WithDisconnectHook(func() { disconnects <- struct{}{} })(&db)
+	WithReconnectHook(func(d time.Duration) { reconnects <- d })(&db)
+
+	m := newMonitor(db.callbacks())
+
+	defer m.close()
+
+	m.changed(true, nil)
+
+	if len(connects) != 0 {
+		t.Fatalf("connect hook called before the connection was in use")
+	}
+
+	m.activate()
+	m.changed(false, nil)
+	m.changed(true, nil)
+
+	select {
+	case got := <-connects:
+		if got != &db {
+			t.Fatalf("connect hook called with another DB")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("connect hook not called")
+	}
+
+	select {
+	case <-disconnects:
+	case <-time.After(time.Second):
+		t.Fatalf("disconnect hook not called")
+	}
+
+	select {
+	case <-reconnects:
+	case <-time.After(time.Second):
+		t.Fatalf("reconnect hook not called")
+	}
+
+	if len(reconnects) != 0 || len(connects) != 0 {
+		t.Fatalf("hooks called more than once")
+	}
+}
+
+func TestInflight(t *testing.T) {
+	var f inflight
+
+	if !f.enter() {
+		t.Fatalf("inflight rejected an operation before close")
+	}
+
+	var stop = f.stopping()
+
+	select {
+	case <-stop:
+		t.Fatalf("inflight stopping before close")
+	default:
+	}
+
+	idle := f.close()
+
+	select {
+	case <-stop:
+	default:
+		t.Fatalf("inflight not stopping after close")
+	}
+
+	if f.enter() {
+		t.Fatalf("inflight accepted an operation after close")
+	}
+
+	select {
+	case <-idle:
+		t.Fatalf("inflight idle with a running operation")
+	default:
+	}
+
+	f.leave()
+
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatalf("inflight not idle after the last operation")
+	}
+}
+
+func TestWithMaxTime(t *testing.T) {
+	db := DB{maxTimeMS: 30 * time.Second}
+
+	if short := db.WithMaxTime(2 * time.Second); short.maxTime("test") != 2*time.Second {
+		t.Fatalf("WithMaxTime handle uses %v", short.maxTime("test"))
+	}
+
+	if db.maxTime("test") != 30*time.Second {
+		t.Fatalf("WithMaxTime changed the parent")
+	}
+}
+
+func TestSetCollectionMaxTime(t *testing.T) {
+	db := DB{maxTimeMS: 30 * time.Second}
+	db.SetCollectionMaxTime("stats", 2*time.Minute)
+
+	if db.maxTime("stats") != 2*time.Minute || db.maxTime("users") != 30*time.Second {
+		t.Fatalf("collection max time not applied")
+	}
+
+	if d := db.Database("analytics").maxTime("stats"); d != 2*time.Minute {
+		t.Fatalf("handle doesn't share collection max times: %v", d)
+	}
+
+	if d := db.WithMaxTime(time.Second).maxTime("stats"); d != time.Second {
+		t.Fatalf("WithMaxTime doesn't override collection max time: %v", d)
+	}
+}
+
+func TestLink(t *testing.T) {
+	var (
+		l        *link
+		old, cur = &conn{}, &conn{}
+	)
+
+	if l.current() != nil || l.acquire() != nil || l.swap(cur) != nil {
+		t.Fatalf("nil link not disconnected")
+	}
+
+	l = &link{conn: old}
+
+	if l.replace(cur, cur) {
+		t.Fatalf("link replaced a conn not in use")
+	}
+
+	if !l.replace(old, cur) || l.current() != cur {
+		t.Fatalf("link did not replace the conn in use")
+	}
+
+	if l.swap(nil) != cur || l.acquire() != nil {
+		t.Fatalf("link still in use after swap")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for update, want := range map[string]bool{
+		`{"name": "ap"}`: true,
+		`{"$set": {"name": "ap"}, "$unset": {"x": 1}}`: true,
+		`{"$set": {"name": "ap"}, "$inc": {"n": 1}}`:   false,
+		`{"$push": {"tags": "new"}}`:                   false,
+	} {
+		var doc M
+		if err := bson.UnmarshalExtJSON([]byte(update), false, &doc); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := idempotent(doc); got != want {
+			t.Errorf("idempotent(%s) = %v, want %v", update, got, want)
+		}
+	}
+
+	if !IsTransient(mongo.CommandError{Code: 10107}) {
+		t.Errorf("NotWritablePrimary not transient")
+	}
+
+	if IsTransient(mongo.CommandError{Code: 11000}) || IsTransient(ErrNotFound) {
+		t.Errorf("permanent error transient")
+	}
+
+	var p = RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if got := p.backoff(retry + 1); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", retry+1, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+
+	if d := p.backoff(1); d < time.Second/2 || d > 3*time.Second/2 {
+		t.Errorf("backoff with jitter = %v", d)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+
+	cancel()
+
+	var (
+		db    = (&DB{}).WithContext(ctx)
+		start = time.Now()
+		retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, Retryable: func(error) bool { return true }}
+	)
+
+	if err := db.retry(retry, &Op{Name: "find", Collection: "devices"}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("retry of a canceled handle returned %v, want context.Canceled", err)
+	}
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("retry of a canceled handle slept %v", took)
+	}
+}
+
+func TestShape(t *testing.T) {
+	for _, tc := range []struct {
+		query interface{}
+		want  string
+	}{
+		{nil, `{}`},
+		{M{"name": "ap-1", "age": M{"$gt": 3}}, `{"age": {"$gt": "?"}, "name": "?"}`},
+		{M{"_id": M{"$in": []int{1, 2}}}, `{"_id": {"$in": "?"}}`},
+		{[]M{{"$match": M{"site": "x"}}, {"$limit": 10}}, `[{"$match": {"site": "?"}}, {"$limit": "?"}]`},
+	} {
+		if got := shape(tc.query); got != tc.want {
+			t.Errorf("shape(%v) = %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+type testLogger struct{ warnings, errors []string }
+
+func (l *testLogger) Debugf(string, ...interface{}) {}
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, format)
+}
+func (l *testLogger) Errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, format)
+}
+
+func TestLogger(t *testing.T) {
+	var (
+		db  = DB{}
+		log = &testLogger{}
+	)
+
+	db.logFailure(&Op{Name: "find", Collection: "devices"}, errors.New("boom"))
+
+	db.SetLogger(log)
+	db.logFailure(&Op{Name: "findOne", Collection: "devices"}, ErrNotFound)
+	db.Database("other").logFailure(&Op{Name: "find", Collection: "devices"}, errors.New("boom"))
+
+	if len(log.errors) != 1 {
+		t.Fatalf("logged %d errors, want 1", len(log.errors))
+	}
+
+	WithSlowThreshold(time.Second)(&db)
+	db.logSlow(&Op{Name: "find", Collection: "devices"}, time.Millisecond)
+	db.logSlow(&Op{Name: "find", Collection: "devices"}, 2*time.Second)
+
+	if len(log.warnings) != 1 {
+		t.Fatalf("logged %d slow operations, want 1", len(log.warnings))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var (
+		db    = DB{}
+		calls []string
+	)
+
+	var trace = func(name string) Middleware {
+		return func(next OpFunc) OpFunc {
+			return func(ctx context.Context, o *Op) error {
+				calls = append(calls, name+" "+o.Name)
+				return next(ctx, o)
+			}
+		}
+	}
+
+	db.Use(trace("outer"))
+	db.Database("other").Use(trace("inner"))
+
+	var err = db.hooks.chain(func(ctx context.Context, o *Op) error {
+		calls = append(calls, "run")
+		return nil
+	})(context.Background(), &Op{Name: "find"})
+
+	if err != nil || strings.Join(calls, ", ") != "outer find, inner find, run" {
+		t.Fatalf("middleware ran as %v, %v", calls, err)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	var (
+		p      poolStats
+		passed int
+		m      = p.poolMonitor(&event.PoolMonitor{Event: func(*event.PoolEvent) { passed++ }})
+	)
+
+	for _, typ := range []string{
+		event.ConnectionCreated, event.ConnectionCreated,
+		event.GetStarted, event.GetSucceeded,
+		event.GetStarted, event.GetFailed,
+		event.GetStarted,
+	} {
+		m.Event(&event.PoolEvent{Type: typ})
+	}
+
+	var want = PoolStats{Open: 2, InUse: 1, Idle: 1, Waiting: 1, CheckOuts: 3, CheckOutFailures: 1}
+
+	if got := p.snapshot(); got != want || passed != 7 {
+		t.Fatalf("pool stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	var db, other = DB{}, DB{}
+
+	WithExpvar("mongo_test")(&db)
+	WithExpvar("mongo_test")(&other)
+
+	db.observe(&Op{Name: "find", Collection: "devices"}, time.Millisecond, nil)
+	other.observe(&Op{Name: "find", Collection: "devices"}, time.Millisecond, errors.New("boom"))
+
+	var want = `{"errors": {"devices.find": 1}, "ops": {"devices.find": 2}}`
+
+	if got := expvar.Get("mongo_test").String(); got != want {
+		t.Fatalf("expvar = %s, want %s", got, want)
+	}
+
+	// concurrent first publications must not panic
+	var done = make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var db DB
+			WithExpvar("mongo_race")(&db)
+			done <- db.optErr == nil
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		if !<-done {
+			t.Fatalf("concurrent WithExpvar failed")
+		}
+	}
+
+	if _, err := NewConnection("mongodb://localhost", WithExpvar("memstats")); err == nil ||
+		!strings.Contains(err.Error(), `"memstats" is published already`) {
+		t.Fatalf("NewConnection with expvar memstats returned %v", err)
+	}
+}
+
+func TestLatencyReport(t *testing.T) {
+	var db = DB{latency: &latencies{}}
+
+	for i := 1; i <= 100; i++ {
+		db.observe(&Op{Name: "find", Collection: "devices"}, time.Duration(i)*time.Millisecond, nil)
+	}
+
+	db.observe(&Op{Name: "count", Collection: "devices"}, time.Millisecond, nil)
+
+	var report = db.LatencyReport()
+
+	if len(report) != 2 || report[0].Operation != "count" || report[1].Count != 100 {
+		t.Fatalf("latency report = %+v", report)
+	}
+
+	for _, p := range []struct{ got, want time.Duration }{
+		{report[1].P50, 50 * time.Millisecond},
+		{report[1].P95, 95 * time.Millisecond},
+		{report[1].P99, 99 * time.Millisecond},
+	} {
+		if p.got < p.want || p.got > p.want*6/5 {
+			t.Errorf("percentile %v, want %v within 20%%", p.got, p.want)
+		}
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	var out = `{"stages": [{"$cursor": {
+		"queryPlanner": {"winningPlan": {"stage": "FETCH", "inputStage": {"stage": "IXSCAN", "indexName": "site_1"}}},
+		"executionStats": {"nReturned": 3, "totalKeysExamined": 3, "totalDocsExamined": 3, "executionTimeMillis": 2}
+	}}, {"$group": {}}]}`
+
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(out), false, &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	var e, err = parseExplain(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.CollScan || len(e.Indexes) != 1 || e.Indexes[0] != "site_1" || e.DocsExamined != 3 ||
+		e.Duration != 2*time.Millisecond {
+		t.Fatalf("explain = %+v", e)
+	}
+}
+
+func TestCollScanCheck(t *testing.T) {
+	var db = DB{}
+
+	WithCollScanCheck(true)(&db)
+
+	var scan = &Op{Name: "find", Collection: "devices", Query: M{"site": "x"}}
+
+	db.collScans.seen.Store(`devices {"site": "?"}`, true)
+
+	if err := db.checkCollScan(scan); !errors.Is(err, ErrCollScan) {
+		t.Fatalf("collection scan passed: %v", err)
+	}
+
+	for _, o := range []*Op{
+		{Name: "find", Collection: "devices"},
+		{Name: "insert", Collection: "devices", Query: M{"site": "x"}},
+		{Name: "find", Collection: "devices", Query: M{"site": "x", "mac": "y"}},
+	} {
+		if err := db.checkCollScan(o); err != nil {
+			t.Errorf("checkCollScan(%+v) = %v", o, err)
+		}
+	}
+}
+
+func TestReplicationLag(t *testing.T) {
+	var now = time.Now()
+
+	var rs = replSetStatus{Members: []replMember{
+		{Name: "a:27017", State: "PRIMARY", Health: 1, OptimeDate: now},
+		{Name: "b:27017", State: "SECONDARY", Health: 1, OptimeDate: now.Add(-2 * time.Second)},
+		{Name: "c:27017", State: "SECONDARY", Health: 0, OptimeDate: now.Add(-time.Hour)},
+	}}
+
+	if lags := rs.lags(); len(lags) != 1 || lags["b:27017"] != 2*time.Second {
+		t.Fatalf("lags = %v", lags)
+	}
+
+	if lag := rs.maxLag(); lag != 2*time.Second {
+		t.Fatalf("max lag = %v", lag)
+	}
+
+	if lag := (&replSetStatus{}).maxLag(); lag != 0 {
+		t.Fatalf("standalone lag = %v", lag)
+	}
+}
+
+func TestIndexUsage(t *testing.T) {
+	var (
+		early = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		late  = early.Add(time.Hour)
+		stats = make([]indexStats, 3)
+	)
+
+	stats[0].Name, stats[0].Accesses.Ops, stats[0].Accesses.Since = "_id_", 10, late
+	stats[1].Name, stats[1].Accesses.Ops, stats[1].Accesses.Since = "name_1", 0, late
+	stats[2].Name, stats[2].Accesses.Ops, stats[2].Accesses.Since = "_id_", 5, early
+
+	var usage = indexUsage(stats)
+
+	if len(usage) != 2 || usage[0].Name != "name_1" || usage[1].Name != "_id_" {
+		t.Fatalf("usage = %+v", usage)
+	}
+
+	if usage[1].Ops != 15 || !usage[1].Since.Equal(early) {
+		t.Fatalf("_id_ usage = %+v, want shards summed up", usage[1])
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var (
+		events []AuditEvent
+		db     = &DB{}
+	)
+
+	WithAuditHook(func(e AuditEvent) { events = append(events, e) })(db)
+
+	var ctx = WithActor(context.Background(), "alice")
+
+	db.hooks.audit(ctx, &Op{Name: "find", Collection: "devices"})
+	db.hooks.audit(ctx, &Op{Name: "remove", Collection: "devices", IDs: queryIDs(M{"_id": M{"$in": []string{"a", "b"}}}), N: 2})
+
+	if len(events) != 1 {
+		t.Fatalf("%d events, want only the write", len(events))
+	}
+
+	if e := events[0]; e.Actor != "alice" || e.Operation != "remove" || e.N != 2 ||
+		len(e.IDs) != 2 || e.IDs[1] != "b" {
+		t.Fatalf("event = %+v", e)
+	}
+
+	for _, query := range []interface{}{nil, M{}, M{"site": "x"}, M{"_id": M{"$gt": 1}}} {
+		if ids := queryIDs(query); ids != nil {
+			t.Fatalf("queryIDs(%v) = %v, want nil", query, ids)
+		}
+	}
+
+	if ids := queryIDs(M{"_id": 7}); len(ids) != 1 || ids[0] != 7 {
+		t.Fatalf("queryIDs = %v", ids)
+	}
+
+	for _, query := range []interface{}{
+		bson.D{{Key: "site", Value: "x"}, {Key: "_id", Value: "a"}},
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A{"a", "b"}}}}},
+		map[string]interface{}{"_id": map[string]interface{}{"$eq": "a"}},
+		Q().In("_id", "a", "b"),
+		Q().Eq("_id", "a").Eq("site", "x"),
+	} {
+		if ids := queryIDs(query); len(ids) == 0 || ids[0] != "a" {
+			t.Errorf("queryIDs(%v) = %v", query, ids)
+		}
+	}
+
+	if ids := queryIDs(bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: 1}}}}); ids != nil {
+		t.Errorf("queryIDs of a range = %v, want nil", ids)
+	}
+
+	var id = primitive.NewObjectID()
+
+	for _, tc := range []struct {
+		op   BulkOp
+		want interface{}
+	}{
+		{BulkInsert(M{"_id": "a", "name": "ap"}), "a"},
+		{BulkUpdate(M{"_id": id}, M{"$set": M{"name": "ap"}}), id},
+		{BulkRemove(Q().Eq("_id", "b")), "b"},
+	} {
+		if _, ids, err := tc.op.model(); err != nil || len(ids) != 1 || ids[0] != tc.want {
+			t.Errorf("ids of %+v = %v, %v, want %v", tc.op, ids, err, tc.want)
+		}
+	}
+
+	var m, ids, err = BulkInsert(M{"name": "ap"}).model()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("ids of an insert without _id = %v, %v", ids, err)
+	}
+
+	var doc = m.(*mongo.InsertOneModel).Document.(bson.Raw)
+
+	if v := doc.Lookup("_id"); v.ObjectID() != ids[0] || doc.Lookup("name").StringValue() != "ap" {
+		t.Fatalf("inserted document %s, want _id %v", doc, ids[0])
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var (
+		db      = &DB{}
+		timeout = mongo.CommandError{Code: 50, Message: "operation exceeded time limit"}
+	)
+
+	WithCircuitBreaker(2, 20*time.Millisecond)(db)
+
+	var b = db.breaker
+
+	// started before the circuit opens
+	var _, lateProbe = b.allow()
+
+	for i := 0; i < 2; i++ {
+		var ok, probe = b.allow()
+		if !ok || probe {
+			t.Fatalf("circuit open after %d failures", i)
+		}
+
+		b.done(probe, timeout, nopLogger{})
+	}
+
+	if ok, _ := b.allow(); ok {
+		t.Fatal("circuit closed after 2 failures")
+	}
+
+	b.done(lateProbe, nil, nopLogger{})
+
+	if ok, _ := b.allow(); ok {
+		t.Fatal("circuit closed by an operation that started before it opened")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	var ok, probe = b.allow()
+	if !ok || !probe {
+		t.Fatal("no probe after the cool-down")
+	}
+
+	if ok, _ := b.allow(); ok {
+		t.Fatal("second operation let through while probing")
+	}
+
+	b.done(probe, timeout, nopLogger{})
+
+	if ok, _ := b.allow(); ok {
+		t.Fatal("circuit closed after a failed probe")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, probe = b.allow(); !probe {
+		t.Fatal("no probe after the cool-down")
+	}
+
+	b.done(probe, errAborted, nopLogger{})
+
+	if _, probe = b.allow(); !probe {
+		t.Fatal("no new probe after the probe panicked")
+	}
+
+	b.done(probe, ErrNotFound, nopLogger{})
+
+	for i := 0; i < 2; i++ {
+		if ok, probe := b.allow(); !ok || probe {
+			t.Fatal("circuit open after a successful probe")
+		}
+	}
+}
+
+func TestWriteLimit(t *testing.T) {
+	var db = &DB{}
+
+	WithCollectionWriteLimit("events", 1000, 10)(db)
+
+	var (
+		ctx   = context.Background()
+		start = time.Now()
+	)
+
+	if err := db.limits.wait(ctx, &Op{Name: "insert", Collection: "events", N: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.limits.wait(ctx, &Op{Name: "find", Collection: "events", N: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.limits.wait(ctx, &Op{Name: "insert", Collection: "other", N: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	if took := time.Since(start); took > 5*time.Millisecond {
+		t.Fatalf("burst, reads and other collections waited %v", took)
+	}
+
+	if err := db.limits.wait(ctx, &Op{Name: "insert", Collection: "events", N: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if took := time.Since(start); took < 15*time.Millisecond {
+		t.Fatalf("20 documents over the burst waited %v, want 20ms", took)
+	}
+
+	var canceled, cancel = context.WithCancel(ctx)
+
+	cancel()
+
+	if err := db.limits.wait(canceled, &Op{Name: "remove", Collection: "events"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait returned %v, want context.Canceled", err)
+	}
+
+	var (
+		retried = &Op{Name: "insert", Collection: "events", N: 100}
+		paid    = time.Now()
+	)
+
+	retried.limited = true
+
+	if err := db.limits.wait(ctx, retried); err != nil {
+		t.Fatal(err)
+	}
+
+	if took := time.Since(paid); took > 5*time.Millisecond {
+		t.Fatalf("retry waited %v for the limit again", took)
+	}
+
+	for _, opt := range []Option{
+		WithWriteLimit(0, 10),
+		WithWriteLimit(-1, 10),
+		WithCollectionWriteLimit("events", 100, 0),
+	} {
+		var db = &DB{}
+
+		if opt(db); db.optErr == nil {
+			t.Error("invalid write limit accepted")
+		}
+
+		if db.limits != nil && (db.limits.all != nil || len(db.limits.colls) > 0) {
+			t.Error("invalid write limit installed")
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	var db = &DB{}
+
+	if stats := db.QueryStats(); len(stats) != 0 {
+		t.Fatalf("stats without WithQueryStats: %v", stats)
+	}
+
+	WithQueryStats()(db)
+
+	db.queries.observe(&Op{Name: "find", Collection: "devices", Query: M{"site": "a"}}, time.Millisecond, nil)
+	db.queries.observe(&Op{Name: "find", Collection: "devices", Query: M{"site": "b"}}, 3*time.Millisecond, errors.New("x"))
+	db.queries.observe(&Op{Name: "find", Collection: "devices", Query: M{"mac": "c"}}, time.Millisecond, nil)
+
+	var stats = db.QueryStats()
+	if len(stats) != 2 {
+		t.Fatalf("%d shapes, want 2", len(stats))
+	}
+
+	if s := stats[0]; s.Shape != `{"site": "?"}` || s.Count != 2 || s.Errors != 1 ||
+		s.Total != 4*time.Millisecond || s.Mean != 2*time.Millisecond || s.Max != 3*time.Millisecond {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	if stats[0].Fingerprint != Fingerprint(M{"site": "z"}) || stats[0].Fingerprint == stats[1].Fingerprint {
+		t.Fatalf("fingerprints %s and %s", stats[0].Fingerprint, stats[1].Fingerprint)
+	}
+}
+
+func TestExtJSON(t *testing.T) {
+	var id, _ = primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e1f")
+
+	for _, c := range []struct {
+		query interface{}
+		want  string
+	}{
+		{nil, "{}"},
+		{M{"_id": id}, `{"_id":{"$oid":"5f1b2c3d4e5f6a7b8c9d0e1f"}}`},
+		{bson.D{{Key: "a", Value: 1}, {Key: "b", Value: "x"}}, `{"a":1,"b":"x"}`},
+		{[]M{{"$match": M{"a": true}}, {"$limit": 5}}, `[{"$match":{"a":true}}, {"$limit":5}]`},
+	} {
+		if got := extJSON(c.query); got != c.want {
+			t.Fatalf("extJSON(%v) = %s, want %s", c.query, got, c.want)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	var (
+		w   = httptest.NewRecorder()
+		rep HealthReport
+	)
+
+	(&DB{}).HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz/mongo", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Connected || rep.Error != ErrNotConnected.Error() {
+		t.Fatalf("report = %+v", rep)
+	}
+}
+
+func TestComment(t *testing.T) {
+	var ctx = context.Background()
+
+	if comment(ctx) != nil || commentValue(ctx) != nil {
+		t.Fatal("comment without WithComment")
+	}
+
+	var db = (&DB{}).Comment("req-42")
+
+	if c := comment(db.parent()); c == nil || *c != "req-42" {
+		t.Fatalf("comment = %v, want req-42", c)
+	}
+
+	if c := commentValue(db.parent()); c != "req-42" {
+		t.Fatalf("comment value = %v, want req-42", c)
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	var (
+		small = M{"n": 1}
+		large = M{"blob": strings.Repeat("x", 6*1024*1024)}
+		docs  = make([]interface{}, 2500)
+	)
+
+	for i := range docs {
+		docs[i] = small
+	}
+
+	var batches, err = splitBatches(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 3 || len(batches[0]) != 1000 || len(batches[2]) != 500 {
+		t.Fatalf("%d batches of 2500 small documents", len(batches))
+	}
+
+	batches, err = splitBatches([]interface{}{large, large, large, small})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 2 {
+		t.Fatalf("large documents split into %d batches", len(batches))
+	}
+
+	if _, err = splitBatches([]interface{}{42}); err == nil {
+		t.Fatal("no error for a document that can't be marshaled")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	var q = Q().
+		Eq("status", "active").
+		Gt("age", 10).Lte("age", 20).
+		In("type", []string{"ap", "switch"}).
+		Nin("site").
+		Or(Q().Exists("mac", true), Q().Regex("name", "^ap", "i"))
+
+	var m = q.M()
+
+	if m["status"] != "active" {
+		t.Fatalf("status = %v", m["status"])
+	}
+
+	if age := m["age"].(M); len(age) != 2 || age["$gt"] != 10 || age["$lte"] != 20 {
+		t.Fatalf("age = %v", age)
+	}
+
+	if in := m["type"].(M)["$in"].([]interface{}); len(in) != 2 || in[1] != "switch" {
+		t.Fatalf("type = %v", m["type"])
+	}
+
+	if nin := m["site"].(M)["$nin"].([]interface{}); nin == nil || len(nin) != 0 {
+		t.Fatalf("site = %v", m["site"])
+	}
+
+	if or := m["$or"].([]M); len(or) != 2 || or[1]["name"].(M)["$options"] != "i" {
+		t.Fatalf("$or = %v", m["$or"])
+	}
+
+	if s := shape(Q().Eq("a", 1).Ne("b", 2)); s != `{"a": "?", "b": {"$ne": "?"}}` {
+		t.Fatalf("shape of a Query = %s", s)
+	}
+}
+
+func TestPipelineBuilder(t *testing.T) {
+	var pipeline, err = Pipeline().
+		Match(Q().Eq("status", "active")).
+		Unwind("tags").
+		Group("$site", M{"n": M{"$sum": 1}}).
+		Sort("-n").
+		Limit(10).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := shape(pipeline); s != `[{"$match": {"status": "?"}}, {"$unwind": "?"}, {"$group": {"_id": "?", "n": {"$sum": "?"}}}, {"$sort": {"n": "?"}}, {"$limit": "?"}]` {
+		t.Fatalf("pipeline = %s", s)
+	}
+
+	_, err = Pipeline().
+		Stage("$out", "archive").
+		Group("$site", M{"n": 1}).
+		Limit(0).
+		Stage("match", M{}).
+		Build()
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Build returned %v, want ErrInvalidQuery", err)
+	}
+
+	for _, mistake := range []string{"$out must be the last", `"n" is not a single accumulator`, "limit 0", `"match"`} {
+		if !strings.Contains(err.Error(), mistake) {
+			t.Fatalf("%v doesn't report %s", err, mistake)
+		}
+	}
+}
+
+func TestDateTrunc(t *testing.T) {
+	for _, c := range []struct {
+		interval time.Duration
+		unit     string
+		binSize  int64
+	}{
+		{24 * time.Hour, "day", 1},
+		{90 * time.Minute, "minute", 90},
+		{6 * time.Hour, "hour", 6},
+		{1500 * time.Millisecond, "millisecond", 1500},
+	} {
+		var trunc, err = dateTrunc("$ts", c.interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if spec := trunc["$dateTrunc"].(M); spec["unit"] != c.unit || spec["binSize"] != c.binSize {
+			t.Fatalf("%v truncates by %v", c.interval, spec)
+		}
+	}
+
+	for _, interval := range []time.Duration{0, time.Microsecond} {
+		if _, err := dateTrunc("$ts", interval); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("interval %v returned %v, want ErrInvalidQuery", interval, err)
+		}
+	}
+}
+
+func TestFilterParams(t *testing.T) {
+	var p = &FilterParams{
+		Fields:       map[string]ParamType{"status": ParamString, "age": ParamInt, "type": ParamString, "created": ParamTime},
+		Operators:    []string{"gte", "in"},
+		DefaultLimit: 20,
+		MaxLimit:     100,
+	}
+
+	var values, _ = url.ParseQuery("filter[status]=active&filter[age][gte]=18&filter[type][in]=ap,switch&sort=-created,status&offset=40&page=2")
+
+	var query, opts, err = p.Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query["status"] != "active" || query["age"].(M)["$gte"] != int64(18) ||
+		len(query["type"].(M)["$in"].([]interface{})) != 2 {
+		t.Fatalf("query = %v", query)
+	}
+
+	if len(opts.Sort) != 2 || opts.Sort[0] != "-created" || opts.Limit != 20 || opts.Skip != 40 {
+		t.Fatalf("options = %+v", opts)
+	}
+
+	if _, opts, _ = p.Parse(url.Values{"limit": {"500"}}); opts.Limit != 100 {
+		t.Fatalf("limit %d, want the maximum of 100", opts.Limit)
+	}
+
+	if _, _, err = p.Parse(url.Values{"page": {"1", "2"}}); err != nil {
+		t.Fatalf("repeated foreign parameter returned %v", err)
+	}
+
+	for _, bad := range []string{
+		"filter[$where]=1",
+		"filter[password]=x",
+		"filter[age][lt]=5",
+		"filter[age]=old",
+		"filter[created][gte]=yesterday",
+		"sort=password",
+		"sort=--age",
+		"limit=-1",
+		"filter[age][gte]=18&filter[age][gte]=99",
+		"sort=age&sort=-age",
+		"offset=0&offset=40",
+	} {
+		var values, _ = url.ParseQuery(bad)
+
+		if _, _, err := p.Parse(values); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("%s returned %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	var fields, err = ParseSort(" -created_at, name,+radio.band")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fields) != 3 || fields[0] != "-created_at" || fields[1] != "name" || fields[2] != "+radio.band" {
+		t.Fatalf("fields = %q", fields)
+	}
+
+	for _, bad := range []string{"", "name,", "$natural", "-$where", "radio..band", "a b", "+-name"} {
+		if _, err = ParseSort(bad); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("ParseSort(%q) returned %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+
+	if _, err = ParseSort("-created_at,secret", "created_at", "name"); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("field outside of allowed returned %v", err)
+	}
+}
+
+func TestSanitizeFilter(t *testing.T) {
+	var body = `{"name": "ap-1", "radio.band": "5", "tags": ["a", {"k": "v"}], "meta": {"site": "x"}}`
+
+	var filter map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &filter); err != nil {
+		t.Fatal(err)
+	}
+
+	var m, err = SanitizeFilter(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 4 || m["radio.band"] != "5" {
+		t.Fatalf("filter = %v", m)
+	}
+
+	for _, bad := range []string{
+		`{"$where": "sleep(1000)"}`,
+		`{"password": {"$ne": ""}}`,
+		`{"tags": [{"$gt": ""}]}`,
+		`{"meta": {"a.b": 1}}`,
+		`{"a.$": 1}`,
+	} {
+		var filter map[string]interface{}
+		if err := json.Unmarshal([]byte(bad), &filter); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := SanitizeFilter(filter); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("SanitizeFilter(%s) returned %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+
+	for _, query := range []interface{}{nil, M{"name": "ap-1"}, filter, bson.D{{Key: "radio.band", Value: "5"}}} {
+		if _, err := sanitizeQuery(query); err != nil {
+			t.Errorf("sanitizeQuery(%v) returned %v", query, err)
+		}
+	}
+
+	for _, query := range []interface{}{
+		M{"password": M{"$ne": ""}},
+		bson.D{{Key: "$where", Value: "sleep(1000)"}},
+		Q().Eq("name", "ap-1"),
+	} {
+		if _, err := sanitizeQuery(query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("sanitizeQuery(%v) returned %v, want ErrInvalidQuery", query, err)
+		}
+	}
+
+	var db = &DB{sanitize: true}
+
+	if err := db.Find("devices", bson.D{{Key: "$where", Value: "sleep(1000)"}}, &[]M{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Find with an operator returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestOrderedQueries(t *testing.T) {
+	var q = Q().Eq("z", 1).Gt("a", 2).Lt("a", 5).Or(Q().Eq("m", 3)).Eq("b", 4)
+
+	var data, err = bson.MarshalExtJSON(q, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := string(data); s != `{"z":1,"a":{"$gt":2,"$lt":5},"$or":[{"m":3}],"b":4}` {
+		t.Fatalf("query = %s", s)
+	}
+
+	pipeline, err := Pipeline().
+		Group("$site", D{{Key: "z", Value: M{"$sum": 1}}, {Key: "a", Value: M{"$max": "$ts"}}}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if group := pipeline[0]["$group"].(D); group[0].Key != "_id" || group[1].Key != "z" || group[2].Key != "a" {
+		t.Fatalf("$group = %v", group)
+	}
+
+	list, err := stages(mongo.Pipeline{{{Key: "$match", Value: M{}}}, {{Key: "$limit", Value: 1}}})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("stages of a mongo.Pipeline = %v, %v", list, err)
+	}
+
+	if list, err = stages(nil); err != nil || len(list) != 0 {
+		t.Fatalf("stages of nil = %v, %v", list, err)
+	}
+
+	if _, err = stages(D{{Key: "$match", Value: M{}}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("stages of a document returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestExtJSONRoundTrip(t *testing.T) {
+	var (
+		id  = primitive.NewObjectID()
+		ts  = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		doc = M{"_id": id, "ts": ts, "n": int64(3)}
+	)
+
+	for _, canonical := range []bool{true, false} {
+		var data, err = ToExtJSON(doc, canonical)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if canonical != strings.Contains(string(data), `"$numberLong":"3"`) {
+			t.Fatalf("canonical %v: %s", canonical, data)
+		}
+
+		var back M
+		if err = FromExtJSON(data, &back); err != nil {
+			t.Fatal(err)
+		}
+
+		// relaxed numbers decode as the smallest type that fits
+		if back["_id"] != id || !back["ts"].(primitive.DateTime).Time().Equal(ts) ||
+			canonical && back["n"] != int64(3) {
+			t.Fatalf("canonical %v: %s decoded as %v", canonical, data, back)
+		}
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	var keys, err = keysetFields("-created,name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(keys, ",") != "-created,name,_id" {
+		t.Fatalf("keys = %q", keys)
+	}
+
+	if keys, _ = keysetFields("-created"); keys[1] != "-_id" {
+		t.Fatalf("keys = %q", keys)
+	}
+
+	var last, _ = bson.Marshal(D{{Key: "_id", Value: 7}, {Key: "created", Value: 3}})
+
+	token, err := encodeToken(last, []string{"-created", "_id"}, "-created,_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := decodeToken(token, "-created,_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := shape(keysetFilter([]string{"-created", "_id"}, values)); s != `{"$or": [{"created": {"$lt": "?"}}, {"_id": {"$gt": "?"}, "created": "?"}]}` {
+		t.Fatalf("filter = %s", s)
+	}
+
+	if values[0].Int32() != 3 || values[1].Int32() != 7 {
+		t.Fatalf("values = %v", values)
+	}
+
+	for _, bad := range []string{"!!", token[:len(token)-4]} {
+		if _, err = decodeToken(bad, "-created,_id"); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("decodeToken(%q) returned %v", bad, err)
+		}
+	}
+
+	if _, err = decodeToken(token, "name,_id"); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("token for another sort returned %v", err)
+	}
+
+	var docs []struct {
+		ID int `bson:"_id"`
+	}
+
+	if err = decodeRaws([]bson.Raw{last}, &docs); err != nil || len(docs) != 1 || docs[0].ID != 7 {
+		t.Fatalf("decodeRaws = %v, %v", docs, err)
+	}
+}
+
+func TestPageJSON(t *testing.T) {
+	var data, err = json.Marshal(Page[M]{Items: []M{}, Total: 3, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := string(data); s != `{"items":[],"total":3,"limit":10,"offset":0}` {
+		t.Fatalf("page = %s", s)
+	}
+}
+
+func TestPushOptions(t *testing.T) {
+	var first = 0
+
+	var spec = (&PushOptions{Position: &first, Slice: -10, Sort: M{"ts": -1}}).each([]interface{}{1})
+	if len(spec) != 4 || spec[1].Key != "$position" || spec[1].Value != 0 || spec[2].Value != -10 {
+		t.Fatalf("spec = %v", spec)
+	}
+
+	if spec = (*PushOptions)(nil).each(nil); len(spec) != 1 || spec[0].Key != "$each" {
+		t.Fatalf("spec without options = %v", spec)
+	}
+
+	var db DB
+	if _, err := db.PullFromArray("test", nil, "", 1); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("PullFromArray without field returned %v, want ErrInvalidQuery", err)
+	}
+
+	if _, err := db.UpsertWithDefaults("test", nil, nil, nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("UpsertWithDefaults without fields returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestBuildUpdate(t *testing.T) {
+	type radio struct {
+		Band    string `bson:"band"`
+		Channel int    `bson:"channel"`
+	}
+
+	type device struct {
+		ID     int      `bson:"_id"`
+		Name   string   `bson:"name"`
+		Radio  radio    `bson:"radio"`
+		Tags   []string `bson:"tags"`
+		Legacy string   `bson:"legacy,omitempty"`
+	}
+
+	var (
+		old     = device{ID: 1, Name: "ap", Radio: radio{"5", 36}, Tags: []string{"a"}, Legacy: "x"}
+		updated = device{ID: 1, Name: "ap", Radio: radio{"5", 40}, Tags: []string{"a", "b"}}
+	)
+
+	var update, err = BuildUpdate(old, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := shape(update); s != `{"$set": {"radio.channel": "?", "tags": "?"}, "$unset": {"legacy": "?"}}` {
+		t.Fatalf("update = %s", s)
+	}
+
+	if update, _ = BuildUpdate(old, old); len(update) != 0 {
+		t.Fatalf("update without changes = %v", update)
+	}
+
+	if _, err = BuildUpdate(M{"a.b": 1}, M{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("dotted field returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	var query, update, err = translatePatch(1, []byte(`[
+		{"op": "test", "path": "/version", "value": 3},
+		{"op": "replace", "path": "/radio/channel", "value": 40},
+		{"op": "add", "path": "/owner", "value": {"$oid": "5f1d7f3e9b1e8a0001a1b2c3"}},
+		{"op": "remove", "path": "/a~1b"},
+		{"op": "add", "path": "/tags/-", "value": "x"},
+		{"op": "add", "path": "/tags/-", "value": "y"},
+		{"op": "add", "path": "/macs/0", "value": "m"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := extJSON(query); s != `{"_id":1,"$expr":{"$eq":["$version",{"$literal":3}]}}` {
+		t.Fatalf("query = %s", s)
+	}
+
+	if v := query[1].Value.(M)["$eq"].(bson.A)[1].(M)["$literal"]; v != int32(3) {
+		t.Fatalf("version decoded as %T", v)
+	}
+
+	if s := extJSON(update); s != `{"$set":{"radio.channel":40,"owner":{"$oid":"5f1d7f3e9b1e8a0001a1b2c3"}},`+
+		`"$unset":{"a/b":""},"$push":{"tags":{"$each":["x","y"]},"macs":{"$each":["m"],"$position":0}}}` {
+		t.Fatalf("update = %s", s)
+	}
+
+	// tests compare whole values, a null value needs the field, operators
+	// in values are literals, a test before a change sees the old value
+	query, _, err = translatePatch(1, []byte(`[
+		{"op": "test", "path": "/tags", "value": ["a", "b"]},
+		{"op": "test", "path": "/x", "value": null},
+		{"op": "test", "path": "/a", "value": {"$ne": 1}},
+		{"op": "remove", "path": "/a"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := extJSON(query); s != `{"_id":1,"x":{"$exists":true},"$expr":{"$and":[`+
+		`{"$eq":["$tags",{"$literal":["a","b"]}]},{"$eq":["$x",{"$literal":null}]},{"$eq":["$a",{"$literal":{"$ne":1}}]}]}}` {
+		t.Fatalf("query = %s", s)
+	}
+
+	// a numeric element of an add path is an array index, even for objects
+	_, update, err = translatePatch(1, []byte(`[{"op": "add", "path": "/meta/0", "value": 1}]`))
+	if err != nil || extJSON(update) != `{"$push":{"meta":{"$each":[1],"$position":0}}}` {
+		t.Fatalf("add to /meta/0 = %s, %v", extJSON(update), err)
+	}
+
+	for _, bad := range []string{
+		`{}`,
+		`[{"op": "replace", "path": "/a", "value": 1}, {"op": "test", "path": "/a", "value": 1}]`,
+		`[{"op": "replace", "path": "/radio", "value": {}}, {"op": "test", "path": "/radio/band", "value": "5"}]`,
+		`[{"op": "add", "path": "/tags/-", "value": 1}, {"op": "test", "path": "/tags", "value": [1]}]`,
+		`[{"op": "test", "path": "/tags/0", "value": "a"}, {"op": "remove", "path": "/b"}]`,
+		`[{"op": "move", "path": "/a", "from": "/b"}]`,
+		`[{"op": "remove", "path": "/tags/1"}]`,
+		`[{"op": "replace", "path": "/radio", "value": 1}, {"op": "remove", "path": "/radio/band"}]`,
+		`[{"op": "replace", "path": "/$where", "value": 1}]`,
+		`[{"op": "replace", "path": "a", "value": 1}]`,
+		`[{"op": "replace", "path": "/a"}]`,
+		`[{"op": "test", "path": "/a", "value": 1}]`,
+	} {
+		if _, _, err = translatePatch(1, []byte(bad)); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("patch %s returned %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+}
+
+func TestUpdateBuilder(t *testing.T) {
+	var update, err = NewUpdate().
+		Set("network.ssid", "office").
+		Inc("stats.count", 1).
+		Unset("legacy").
+		Set("network.ssid", "lab").
+		Set("radios.$[r].channel", 6).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := extJSON(update); s != `{"$set":{"network.ssid":"lab","radios.$[r].channel":6},"$inc":{"stats.count":1},"$unset":{"legacy":""}}` {
+		t.Fatalf("update = %s", s)
+	}
+
+	_, err = NewUpdate().
+		Set("", 1).
+		Set("$where", 1).
+		Inc("n", "1").
+		Set("network", M{}).
+		Unset("network.ssid").
+		Set("a", 1).
+		Unset("a").
+		Build()
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Build returned %v, want ErrInvalidQuery", err)
+	}
+
+	for _, mistake := range []string{`"$where"`, "string is not a number", "network.ssid conflicts with $set of network", "a conflicts with $set"} {
+		if !strings.Contains(err.Error(), mistake) {
+			t.Fatalf("%v doesn't report %s", err, mistake)
+		}
+	}
+
+	if _, err = NewUpdate().Build(); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("empty update returned %v, want ErrInvalidQuery", err)
+	}
+
+	if _, err = bson.Marshal(NewUpdate().Set("a..b", 1)); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("marshalling an invalid update returned %v", err)
+	}
+
+	for _, tc := range []struct {
+		v    interface{}
+		want string
+	}{
+		{M{"name": "ap"}, `{"$set":{"name":"ap"}}`},
+		{NewUpdate().Set("name", "ap").Inc("n", 1), `{"$set":{"name":"ap"},"$inc":{"n":1}}`},
+	} {
+		var update, err = setUpdate(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := extJSON(update); got != tc.want {
+			t.Errorf("update of %v = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+
+	var db = &DB{}
+
+	if _, err = db.Update("devices", 1, NewUpdate().Inc("n", "x")); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Update with an invalid builder returned %v, want ErrInvalidQuery", err)
+	}
+
+	if _, err = db.UpsertWithDefaults("devices", M{"_id": 1}, NewUpdate().Set("name", "ap"), nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("UpsertWithDefaults with a builder returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestCollScanFiltered(t *testing.T) {
+	var pipeline, _ = Pipeline().Match(nil).Match(Q()).Group("$site", M{"n": M{"$sum": 1}}).Build()
+	if len(pipeline) != 1 {
+		t.Fatalf("empty matches added stages: %v", pipeline)
+	}
+
+	for _, c := range []struct {
+		pipeline interface{}
+		filtered bool
+	}{
+		{nil, false},
+		{pipeline, false},
+		{[]M{{"$match": M{}}, {"$count": "n"}}, false},
+		{[]M{{"$match": M{"site": 1}}}, true},
+		{mongo.Pipeline{{{Key: "$match", Value: Q().Eq("site", 1)}}}, true},
+		{[]M{{"$sort": M{"ts": 1}}, {"$match": M{"site": 1}}}, false},
+	} {
+		if filtered(c.pipeline) != c.filtered {
+			t.Fatalf("filtered(%s) = %v", shape(c.pipeline), !c.filtered)
+		}
+	}
+}
+
+func TestNoReplicationInfo(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		none bool
+	}{
+		{nil, false},
+		{mongo.CommandError{Code: 76, Name: "NoReplicationEnabled"}, true},
+		{mongo.CommandError{Code: 59, Name: "CommandNotFound"}, true},
+		{fmt.Errorf("admin: %w", mongo.CommandError{Code: 13, Name: "Unauthorized"}), true},
+		{mongo.CommandError{Code: 11600, Name: "InterruptedAtShutdown"}, false},
+		{ErrNotConnected, false},
+	} {
+		if noReplicationInfo(c.err) != c.none {
+			t.Fatalf("noReplicationInfo(%v) = %v", c.err, !c.none)
+		}
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	var db DB
+
+	// intervals that aren't positive made time.NewTicker panic
+	for _, interval := range []time.Duration{0, -time.Second} {
+		db.PollServerStatus(interval, func(*ServerMetrics) {})()
+		db.WatchReplicationLag(time.Second, interval, func(bool, time.Duration) {})()
+		db.ReapOps(time.Minute, interval)()
+	}
+}
+
+func TestPagePipeline(t *testing.T) {
+	for _, c := range []struct {
+		opts *FindOptions
+		want string
+	}{
+		{&FindOptions{}, `[{"$match":{}}, {"$facet":{"items":[{"$match":{}}],"total":[{"$count":"n"}]}}]`},
+		{&FindOptions{Limit: 10}, `[{"$match":{}}, {"$facet":{"items":[{"$limit":10}],"total":[{"$count":"n"}]}}]`},
+		{&FindOptions{Sort: []string{"-ts", "name"}, Skip: 20, Limit: 10, Projection: M{"name": 1}},
+			`[{"$match":{}}, {"$sort":{"ts":-1,"name":1}}, {"$facet":{"items":[{"$skip":20},{"$limit":10},{"$project":{"name":1}}],"total":[{"$count":"n"}]}}]`},
+	} {
+		if s := extJSON(pagePipeline(nil, c.opts)); s != c.want {
+			t.Errorf("pipeline = %s, want %s", s, c.want)
+		}
+	}
+
+	if s := shape(pagePipeline(Q().Eq("site", 1), &FindOptions{})[0]); s != `{"$match": {"site": "?"}}` {
+		t.Fatalf("$match = %s", s)
+	}
+}
+
+func TestMapReduceCommand(t *testing.T) {
+	var job = &MapReduce{
+		Map:    "function() { emit(this.model, 1) }",
+		Reduce: "function(k, v) { return Array.sum(v) }",
+		Sort:   []string{"-ts"},
+		Limit:  10,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		maxTime time.Duration
+		comment interface{}
+		want    string
+	}{
+		{"plain", 0, nil, `{"mapReduce":"devices","map":{"$code":"function() { emit(this.model, 1) }"},"reduce":{"$code":"function(k, v) { return Array.sum(v) }"},"query":{"site":"hq"},"sort":{"ts":-1},"limit":10,"out":{"inline":1}}`},
+		{"bounded", 5 * time.Second, "report", `{"mapReduce":"devices","map":{"$code":"function() { emit(this.model, 1) }"},"reduce":{"$code":"function(k, v) { return Array.sum(v) }"},"query":{"site":"hq"},"sort":{"ts":-1},"limit":10,"out":{"inline":1},"maxTimeMS":5000,"comment":"report"}`},
+	} {
+		var cmd = mapReduceCommand("devices", M{"site": "hq"}, job, tc.maxTime, tc.comment)
+
+		if got := extJSON(cmd); got != tc.want {
+			t.Errorf("%s: command\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+
+	var db = &DB{}
+
+	for _, job := range []*MapReduce{nil, {Map: "function() {}"}} {
+		if err := db.MapReduce("devices", nil, job, nil); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("MapReduce(%+v) returned %v, want ErrInvalidQuery", job, err)
+		}
+	}
+}
+
+func TestGridFS(t *testing.T) {
+	// the client connects lazily, so no server is needed to open buckets
+	var client, err = mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Disconnect(context.Background())
+
+	for name, want := range map[string]string{"": "fs", "firmware": "firmware"} {
+		var b, err = newBucket(client.Database("test"), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if files, chunks := b.GetFilesCollection().Name(), b.GetChunksCollection().Name(); files != want+".files" || chunks != want+".chunks" {
+			t.Errorf("bucket %q uses %s and %s", name, files, chunks)
+		}
+	}
+
+	if err = fileError("fw.bin", gridfs.ErrFileNotFound); !errors.Is(err, ErrNotFound) || err.Error() != "fw.bin: "+ErrNotFound.Error() {
+		t.Errorf("missing file = %v, want ErrNotFound", err)
+	}
+
+	var o = &Op{Name: "putFile"}
+
+	if err = (&DB{}).gridfs(o, "", nil); !errors.Is(err, ErrNotConnected) || o.Collection != "fs.files" {
+		t.Errorf("gridfs returned %v for collection %q", err, o.Collection)
+	}
+}
+
+func TestBulkWrite(t *testing.T) {
+	for _, tc := range []struct {
+		op   BulkOp
+		want string
+	}{
+		{BulkInsert(M{"_id": 1}), "*mongo.InsertOneModel"},
+		{BulkUpdate(M{"_id": 1}, M{"$set": M{"a": 1}}), "*mongo.UpdateOneModel"},
+		{BulkUpdate(M{"_id": 1}, M{"a": 1}), "*mongo.ReplaceOneModel"},
+		{BulkUpdateAll(M{"a": 1}, M{"$set": M{"b": 1}}), "*mongo.UpdateManyModel"},
+		{BulkUpsert(M{"_id": 1}, M{"$set": M{"a": 1}}), "*mongo.UpdateOneModel"},
+		{BulkRemove(M{"_id": 1}), "*mongo.DeleteOneModel"},
+		{BulkRemoveAll(M{"a": 1}), "*mongo.DeleteManyModel"},
+	} {
+		var m, _, err = tc.op.model()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fmt.Sprintf("%T", m); got != tc.want {
+			t.Errorf("model of %+v is %s, want %s", tc.op, got, tc.want)
+		}
+	}
+
+	var m, _, _ = BulkUpsert(M{"_id": 1}, M{"a": 1}).model()
+	if r, ok := m.(*mongo.ReplaceOneModel); !ok || r.Upsert == nil || !*r.Upsert {
+		t.Errorf("upsert replacing a document is %+v", m)
+	}
+
+	var (
+		ops = []BulkOp{
+			BulkInsert(M{"_id": "a"}),
+			BulkInsert(M{"_id": "a"}),
+			BulkUpsert(M{"site": "hq"}, M{"$set": M{"n": 1}}),
+			BulkRemove(M{"_id": "b"}),
+		}
+		ids = [][]interface{}{{"a"}, {"a2"}, nil, {"b"}}
+		res = &mongo.BulkWriteResult{InsertedCount: 1, MatchedCount: 0,
+			UpsertedCount: 1, DeletedCount: 1, UpsertedIDs: map[int64]interface{}{2: "x"}}
+		dup = mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}},
+		}}
+	)
+
+	for _, tc := range []struct {
+		ordered bool
+		status  []BulkStatus
+		written string
+	}{
+		{true, []BulkStatus{BulkApplied, BulkFailed, BulkSkipped, BulkSkipped}, "[a]"},
+		{false, []BulkStatus{BulkApplied, BulkFailed, BulkApplied, BulkApplied}, "[a x b]"},
+	} {
+		var result = newBulkResult(len(ops))
+
+		result.fill(res, dup, tc.ordered)
+
+		if fmt.Sprint(result.Status) != fmt.Sprint(tc.status) {
+			t.Errorf("ordered %v: status = %v, want %v", tc.ordered, result.Status, tc.status)
+		}
+
+		if written := fmt.Sprint(result.applied(ops, ids)); written != tc.written {
+			t.Errorf("ordered %v: written ids = %s, want %s", tc.ordered, written, tc.written)
+		}
+
+		if len(result.InsertedIDs) != 1 || result.InsertedIDs[0] != "a" {
+			t.Errorf("ordered %v: inserted ids = %v", tc.ordered, result.InsertedIDs)
+		}
+
+		if result.Inserted != 1 || result.Upserted != 1 || result.Removed != 1 || result.UpsertedIDs[2] != "x" {
+			t.Errorf("ordered %v: result = %+v", tc.ordered, result)
+		}
+
+		if len(result.Errors) != 1 || result.Errors[0].Index != 1 || result.Errors[0].Code != 11000 {
+			t.Errorf("ordered %v: errors = %+v", tc.ordered, result.Errors)
+		}
+	}
+
+	var done = newBulkResult(len(ops))
+
+	if done.fill(res, nil, true); fmt.Sprint(done.Status) != fmt.Sprint([]BulkStatus{BulkApplied, BulkApplied, BulkApplied, BulkApplied}) {
+		t.Errorf("status of a successful write = %v", done.Status)
+	}
+
+	var failed = newBulkResult(len(ops))
+
+	if failed.fill(nil, ErrNotFound, true); failed.Status[0] != BulkUnknown || failed.Inserted != 0 || len(failed.Errors) != 0 {
+		t.Errorf("result of a failed write = %+v", failed)
+	}
+
+	if ids := failed.applied(ops, ids); len(ids) != 0 || len(failed.InsertedIDs) != 0 {
+		t.Errorf("ids of a failed write = %v, %v", ids, failed.InsertedIDs)
+	}
+
+	if _, err := (&DB{}).BulkWrite("devices", nil, true); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("empty BulkWrite returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestFindOneAndUpdate(t *testing.T) {
+	for _, returnNew := range []bool{false, true} {
+		var opts = findOneAndUpdateOptions(5*time.Second, returnNew)
+
+		if after := opts.ReturnDocument != nil && *opts.ReturnDocument == options.After; after != returnNew {
+			t.Errorf("returnNew %v returns the document after the update: %v", returnNew, after)
+		}
+
+		if opts.MaxTime == nil || *opts.MaxTime != 5*time.Second {
+			t.Errorf("max time = %v", opts.MaxTime)
+		}
+
+		if opts.Upsert != nil && *opts.Upsert {
+			t.Error("FindOneAndUpdate upserts")
+		}
+	}
+
+	var db = &DB{}
+
+	for _, update := range []interface{}{M{"state": "claimed"}, nil, NewUpdate().Inc("n", "x")} {
+		if err := db.FindOneAndUpdate("jobs", M{"state": "new"}, update, true, nil); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("FindOneAndUpdate with update %v returned %v, want ErrInvalidQuery", update, err)
+		}
+	}
+
+	if err := db.FindOneAndUpdate("jobs", M{"state": "new"}, NewUpdate().Set("state", "claimed"), true, nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("FindOneAndUpdate with a builder returned %v, want ErrNotConnected", err)
+	}
+
+	var job M
+
+	var doc = mongo.NewSingleResultFromDocument(bson.D{{Key: "state", Value: "new"}}, nil, nil)
+
+	if err := decodeResult(doc, &job); err != nil || job["state"] != "new" {
+		t.Fatalf("decoded %v, %v", job, err)
+	}
+
+	if err := decodeResult(doc, nil); err != nil {
+		t.Fatalf("result without v returned %v", err)
+	}
+
+	var none = mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+
+	for _, v := range []interface{}{nil, &job} {
+		if err := decodeResult(none, v); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("no document decoded into %v returned %v, want ErrNotFound", v, err)
+		}
+	}
+}
+
+func TestFindOneAndDeleteReplace(t *testing.T) {
+	for _, returnNew := range []bool{false, true} {
+		var opts = findOneAndReplaceOptions(time.Second, returnNew)
+
+		if after := opts.ReturnDocument != nil && *opts.ReturnDocument == options.After; after != returnNew {
+			t.Errorf("returnNew %v returns the document after the replacement: %v", returnNew, after)
+		}
+
+		if opts.MaxTime == nil || *opts.MaxTime != time.Second || opts.Upsert != nil {
+			t.Errorf("options = %+v", opts)
+		}
+	}
+
+	var db = &DB{}
+
+	for _, doc := range []interface{}{M{"$set": M{"name": "ap"}}, nil} {
+		if err := db.FindOneAndReplace("devices", M{"_id": "a"}, doc, false, nil); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("FindOneAndReplace with %v returned %v, want ErrInvalidQuery", doc, err)
+		}
+	}
+
+	if err := db.FindOneAndReplace("devices", M{"_id": "a"}, M{"name": "ap"}, false, nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("FindOneAndReplace with a document returned %v, want ErrNotConnected", err)
+	}
+
+	// an empty queue, as FindOneAndDelete gets it from the driver
+	var none = mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+
+	if err := decodeResult(none, &M{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pop of an empty queue returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindOptionsTotal(t *testing.T) {
+	var (
+		db = &DB{}
+		n  = -1
+	)
+
+	if err := db.FindWithOptions("devices", nil, &[]M{}, &FindOptions{Total: &n}); !errors.Is(err, ErrInvalidQuery) || n != -1 {
+		t.Fatalf("total without a limit returned %v, total %d", err, n)
+	}
+
+	var want = `[{"$match":{"site":"hq"}}, {"$sort":{"name":1}}, {"$facet":{"items":[{"$limit":20}],"total":[{"$count":"n"}]}}]`
+
+	if s := extJSON(pagePipeline(M{"site": "hq"}, &FindOptions{Sort: []string{"name"}, Limit: 20, Total: &n})); s != want {
+		t.Fatalf("pipeline = %s, want %s", s, want)
+	}
+}
+
+func TestPageResult(t *testing.T) {
+	for _, c := range []struct {
+		reply string
+		n     int
+		total int
+	}{
+		{`{"items": [{"name": "ap-3"}, {"name": "ap-4"}], "total": [{"n": 42}]}`, 2, 42},
+		{`{"items": [], "total": []}`, 0, 0},
+	} {
+		var p page
+		if err := bson.UnmarshalExtJSON([]byte(c.reply), false, &p); err != nil {
+			t.Fatal(err)
+		}
+
+		var devices []M
+
+		if total, err := p.decode(&devices); err != nil || total != c.total || len(devices) != c.n {
+			t.Errorf("page of %s = %v of %d, %v", c.reply, devices, total, err)
+		}
+	}
+}
+
+func TestFindTotal(t *testing.T) {
+	var (
+		db    = &DB{}
+		total = -1
+	)
+
+	if err := db.FindWithQuerySortLimitOffsetTotalAll("devices", nil, "", 0, 0, &[]M{}, &total); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("unbounded page with a total returned %v, want ErrInvalidQuery", err)
+	}
+
+	if total != -1 {
+		t.Fatalf("total of a rejected query set to %d", total)
+	}
+
+	if _, err := db.FindPage("devices", nil, "name", -1, 0, &[]M{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("FindPage without a limit returned %v, want ErrInvalidQuery", err)
+	}
+
+	// the options of FindWithQuerySortLimitOffsetTotalAll(coll, q, "", 10, 0, ...)
+	var want = `[{"$match":{}}, {"$facet":{"items":[{"$limit":10}],"total":[{"$count":"n"}]}}]`
+
+	if s := extJSON(pagePipeline(nil, &FindOptions{Limit: 10})); s != want {
+		t.Fatalf("pipeline = %s, want %s", s, want)
+	}
+}
+
+func TestUpsertDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		set, setOnInsert interface{}
+		want             string
+	}{
+		{M{"seen": 1}, M{"created": 0}, `{"$set":{"seen":1},"$setOnInsert":{"created":0}}`},
+		{M{"seen": 1}, nil, `{"$set":{"seen":1}}`},
+		{nil, M{"created": 0}, `{"$setOnInsert":{"created":0}}`},
+	} {
+		var update, err = upsertDefaults(tc.set, tc.setOnInsert)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := extJSON(update); got != tc.want {
+			t.Errorf("update = %s, want %s", got, tc.want)
+		}
+	}
+
+	for _, tc := range [][2]interface{}{{nil, nil}, {nil, NewUpdate().Set("a", 1)}} {
+		if _, err := upsertDefaults(tc[0], tc[1]); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("upsertDefaults(%v, %v) returned %v, want ErrInvalidQuery", tc[0], tc[1], err)
+		}
+	}
+}
+
+func TestUpsertModels(t *testing.T) {
+	var models, err = upsertModels([]interface{}{1, 2}, []interface{}{M{"$set": M{"a": 1}}, M{"a": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u, ok := models[0].(*mongo.UpdateOneModel); !ok || u.Upsert == nil || !*u.Upsert || extJSON(u.Filter) != `{"_id":1}` {
+		t.Errorf("update = %+v", models[0])
+	}
+
+	if r, ok := models[1].(*mongo.ReplaceOneModel); !ok || r.Upsert == nil || !*r.Upsert || extJSON(r.Filter) != `{"_id":2}` {
+		t.Errorf("replacement = %+v", models[1])
+	}
+
+	if _, err = upsertModels([]interface{}{1}, nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("mismatched ids returned %v, want ErrInvalidQuery", err)
+	}
+
+	if err = (&DB{}).UpsertMulti("devices", []interface{}{1}, []interface{}{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("UpsertMulti with mismatched ids returned %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestTextQuery(t *testing.T) {
+	for _, tc := range []struct {
+		filter interface{}
+		want   string
+	}{
+		{nil, `{"$text":{"$search":"ap"}}`},
+		{M{"site": "hq"}, `{"$and":[{"$text":{"$search":"ap"}},{"site":"hq"}]}`},
+		{bson.D{{Key: "site", Value: "hq"}}, `{"$and":[{"$text":{"$search":"ap"}},{"site":"hq"}]}`},
+		{Q().Eq("site", "hq"), `{"$and":[{"$text":{"$search":"ap"}},{"site":"hq"}]}`},
+	} {
+		var query, err = textQuery("ap", &TextSearchOptions{Filter: tc.filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := extJSON(query); got != tc.want {
+			t.Errorf("query with filter %v = %s, want %s", tc.filter, got, tc.want)
+		}
+	}
+
+	for _, f := range []interface{}{
+		M{"$text": M{"$search": "x"}},
+		bson.D{{Key: "$text", Value: M{"$search": "x"}}},
+	} {
+		if _, err := textQuery("ap", &TextSearchOptions{Filter: f}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("filter %v returned %v, want ErrInvalidQuery", f, err)
+		}
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	for _, opt := range []Option{WithPoolLimit(-1), WithMinPoolSize(-5), WithMaxConnecting(-1)} {
+		var db = &DB{}
+
+		if opt(db); db.optErr == nil || len(db.clientOpts) != 0 {
+			t.Errorf("negative pool size accepted: %v", db.clientOpts)
+		}
+	}
+
+	var db = &DB{}
+
+	WithPoolLimit(50)(db)
+
+	if db.optErr != nil || len(db.clientOpts) != 1 || *db.clientOpts[0].MaxPoolSize != 50 {
+		t.Errorf("pool limit 50 gave %v, %v", db.clientOpts, db.optErr)
+	}
 }
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate documents per second with bursts of up to burst.
+// It goes into debt for batches larger than burst, so that they are delayed
+// instead of blocked forever
+type tokenBucket struct {
+	sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes n tokens and returns how long to wait until they are
+// available
+func (b *tokenBucket) reserve(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	var now = time.Now()
+
+	b.tokens += b.rate * now.Sub(b.last).Seconds()
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// writeLimits throttle the writes of a connection, shared by a DB and its
+// handles
+type writeLimits struct {
+	all   *tokenBucket
+	colls map[string]*tokenBucket
+}
+
+func (db *DB) writeLimits() *writeLimits {
+	if db.limits == nil {
+		db.limits = &writeLimits{colls: map[string]*tokenBucket{}}
+	}
+
+	return db.limits
+}
+
+// WithWriteLimit throttles writes to all collections to perSecond
+// documents, with bursts of up to burst, e.g. so that a bulk import doesn't
+// starve interactive traffic. Writes wait for their turn before they start,
+// inserts count every document and other writes count one, retries don't
+// count again. perSecond must be positive and burst at least 1
+func WithWriteLimit(perSecond float64, burst int) Option {
+	return func(db *DB) {
+		if err := checkLimit(perSecond, burst); err != nil {
+			db.invalid(err)
+			return
+		}
+
+		db.writeLimits().all = newTokenBucket(perSecond, burst)
+	}
+}
+
+// WithCollectionWriteLimit is WithWriteLimit for coll only, a limit for all
+// collections applies as well
+func WithCollectionWriteLimit(coll string, perSecond float64, burst int) Option {
+	return func(db *DB) {
+		if err := checkLimit(perSecond, burst); err != nil {
+			db.invalid(fmt.Errorf("%s: %w", coll, err))
+			return
+		}
+
+		db.writeLimits().colls[coll] = newTokenBucket(perSecond, burst)
+	}
+}
+
+// checkLimit fails for write limits that would never let a write through
+// or never hold one back
+func checkLimit(perSecond float64, burst int) error {
+	if !(perSecond > 0) || math.IsInf(perSecond, 1) || burst < 1 {
+		return fmt.Errorf("write limit of %v per second with bursts of %d: rate must be positive and burst at least 1", perSecond, burst)
+	}
+
+	return nil
+}
+
+// wait delays the write o until the limits allow it or ctx is done
+func (l *writeLimits) wait(ctx context.Context, o *Op) error {
+	if l == nil || !writeOps[o.Name] || o.limited {
+		return nil
+	}
+
+	o.limited = true
+
+	var n = o.N
+	if n < 1 {
+		n = 1
+	}
+
+	var d = l.all.reserve(n)
+	if dc := l.colls[o.Collection].reserve(n); dc > d {
+		d = dc
+	}
+
+	if d <= 0 {
+		return nil
+	}
+
+	var timer = time.NewTimer(d)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Logger receives the log output of the package, e.g. a zap.SugaredLogger.
+// Connection changes and retries are logged as warnings, failed operations
+// as errors and routine connection events as debug messages
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// WithLogger logs through l from the start, see SetLogger
+func WithLogger(l Logger) Option {
+	return func(db *DB) {
+		db.callbacks().setLogger(l)
+	}
+}
+
+// SetLogger logs through l, it applies to all handles of the connection.
+// Nil silences the package again
+func (db *DB) SetLogger(l Logger) {
+	db.callbacks().setLogger(l)
+}
+
+func (db *DB) logger() Logger {
+	return db.hooks.logger()
+}
+
+func (h *hooks) setLogger(l Logger) {
+	h.Lock()
+	h.log = l
+	h.Unlock()
+}
+
+func (h *hooks) logger() Logger {
+	if h == nil {
+		return nopLogger{}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if h.log == nil {
+		return nopLogger{}
+	}
+
+	return h.log
+}
+
+// SetDebug logs every operation as a debug message with its query or
+// pipeline in relaxed extended JSON, as pasteable into the shell, and its
+// duration. It applies to all handles of the connection
+func (db *DB) SetDebug(on bool) {
+	var h = db.callbacks()
+
+	h.Lock()
+	h.debug = on
+	h.Unlock()
+}
+
+func (h *hooks) debugging() bool {
+	if h == nil {
+		return false
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	return h.debug
+}
+
+func (db *DB) logDebug(o *Op, took time.Duration, err error) {
+	if !db.hooks.debugging() {
+		return
+	}
+
+	if err != nil {
+		db.logger().Debugf("mongo: %s %s %s took %v: %v", o.Name, o.Collection, extJSON(o.Query), took, err)
+		return
+	}
+
+	db.logger().Debugf("mongo: %s %s %s took %v, %d documents", o.Name, o.Collection, extJSON(o.Query), took, o.N)
+}
+
+// extJSON renders a query or pipeline as relaxed extended JSON
+func extJSON(query interface{}) string {
+	if query == nil {
+		return "{}"
+	}
+
+	// pipelines are arrays, which MarshalExtJSON only takes as elements of a
+	// document, unlike documents stored as bson.D or bson.Raw
+	var v = reflect.ValueOf(query)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array ||
+		v.Type() == reflect.TypeOf(bson.D{}) || v.Type().Elem().Kind() == reflect.Uint8 {
+		var data, err = bson.MarshalExtJSON(query, false, false)
+		if err != nil {
+			return fmt.Sprintf("%v", query)
+		}
+
+		return string(data)
+	}
+
+	var stages = make([]string, v.Len())
+	for i := range stages {
+		stages[i] = extJSON(v.Index(i).Interface())
+	}
+
+	return "[" + strings.Join(stages, ", ") + "]"
+}
+
+// WithSlowThreshold logs operations taking longer than d as warnings with
+// their collection, query shape, duration and number of documents
+func WithSlowThreshold(d time.Duration) Option {
+	return func(db *DB) {
+		db.slowOp = d
+	}
+}
+
+func (db *DB) logSlow(o *Op, took time.Duration) {
+	if db.slowOp > 0 && took > db.slowOp {
+		db.logger().Warnf("mongo: slow %s %s %s took %v, %d documents",
+			o.Name, o.Collection, shape(o.Query), took, o.N)
+	}
+}
+
+// logFailure logs a failed operation, not finding a document is no failure
+func (db *DB) logFailure(o *Op, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		db.logger().Errorf("mongo: %s %s: %v", o.Name, o.Collection, err)
+	}
+}
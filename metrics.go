@@ -0,0 +1,97 @@
+package mongo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics collects per operation and collection counts, errors, durations
+// and result sizes. It is a prometheus.Collector, register it and pass it
+// to WithMetrics, e.g.
+//
+//	var m = mongo.NewMetrics("app")
+//	prometheus.MustRegister(m)
+//	db, err := mongo.NewConnection(dsn, mongo.WithMetrics(m))
+//
+// Retries count as separate operations, ErrNotFound is not an error
+type Metrics struct {
+	ops      *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	docs     *prometheus.HistogramVec
+}
+
+// NewMetrics creates the metrics prefixed with namespace_mongo_
+func NewMetrics(namespace string) *Metrics {
+	var labels = []string{"operation", "collection"}
+
+	return &Metrics{
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "mongo",
+			Name:      "operations_total",
+			Help:      "Operations run.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "mongo",
+			Name:      "operation_errors_total",
+			Help:      "Operations that failed.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "mongo",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+		docs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "mongo",
+			Name:      "operation_documents",
+			Help:      "Documents returned or affected by successful operations.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}, labels),
+	}
+}
+
+// WithMetrics records the operations of the connection in m
+func WithMetrics(m *Metrics) Option {
+	return func(db *DB) {
+		db.metrics = m
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.ops.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+	m.docs.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.ops.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+	m.docs.Collect(ch)
+}
+
+func (m *Metrics) observe(o *Op, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.ops.WithLabelValues(o.Name, o.Collection).Inc()
+	m.duration.WithLabelValues(o.Name, o.Collection).Observe(d.Seconds())
+
+	switch {
+	case err == nil:
+		m.docs.WithLabelValues(o.Name, o.Collection).Observe(float64(o.N))
+	case !errors.Is(err, ErrNotFound):
+		m.errors.WithLabelValues(o.Name, o.Collection).Inc()
+	}
+}
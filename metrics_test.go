@@ -0,0 +1,29 @@
+package mongo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	var m = NewMetrics("test")
+
+	m.observe(&Op{Name: "find", Collection: "devices", N: 3}, time.Millisecond, nil)
+	m.observe(&Op{Name: "findOne", Collection: "devices"}, time.Millisecond, ErrNotFound)
+	m.observe(&Op{Name: "find", Collection: "devices"}, time.Millisecond, errors.New("boom"))
+
+	if n := testutil.ToFloat64(m.ops.WithLabelValues("find", "devices")); n != 2 {
+		t.Errorf("find operations = %v, want 2", n)
+	}
+
+	if n := testutil.CollectAndCount(m.errors); n != 1 {
+		t.Errorf("error series = %v, want 1 since ErrNotFound is no error", n)
+	}
+
+	if n := testutil.CollectAndCount(m, "test_mongo_operation_documents"); n != 1 {
+		t.Errorf("document series = %v, want 1", n)
+	}
+}
@@ -0,0 +1,73 @@
+package mongo
+
+import "context"
+
+// Op describes an operation passed through middleware
+type Op struct {
+	// Name of the operation, e.g. "find", "update" or "aggregate"
+	Name       string
+	Collection string
+
+	// Query is the filter or pipeline, nil for inserts and index changes
+	Query interface{}
+
+	// Result points to the value reads decode into, nil for writes.
+	// Middleware answering a read itself, e.g. from a cache, fills it
+	Result interface{}
+
+	// N is the number of documents returned or affected, set once the
+	// operation finished
+	N int
+
+	// IDs of the documents written as far as known: the inserted and
+	// upserted ones and those selected by _id
+	IDs []interface{}
+
+	// limited is set once the write limits were paid for, so that retries
+	// don't pay again
+	limited bool
+}
+
+// OpFunc runs an operation
+type OpFunc func(ctx context.Context, o *Op) error
+
+// Middleware wraps the operations of a connection, it may inspect o, pass
+// another ctx to next, answer without calling next or handle its error
+type Middleware func(next OpFunc) OpFunc
+
+// Use adds middleware to all handles of the connection, the first one added
+// is the outermost. It runs for every attempt of an operation, inside of
+// metrics and tracing, e.g.
+//
+//	db.Use(func(next mongo.OpFunc) mongo.OpFunc {
+//		return func(ctx context.Context, o *mongo.Op) error {
+//			if o.Collection == "secrets" && !isAdmin(ctx) {
+//				return errForbidden
+//			}
+//			return next(ctx, o)
+//		}
+//	})
+func (db *DB) Use(mw ...Middleware) {
+	var h = db.callbacks()
+
+	h.Lock()
+	h.middleware = append(h.middleware[:len(h.middleware):len(h.middleware)], mw...)
+	h.Unlock()
+}
+
+// chain wraps fn in the middleware
+func (h *hooks) chain(fn OpFunc) OpFunc {
+	if h == nil {
+		return fn
+	}
+
+	h.Lock()
+	var mw = h.middleware
+	h.Unlock()
+
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+
+	return fn
+}
@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOneAndUpdate atomically applies update to the first document matching
+// query and decodes it into v, as it was before the update or after it if
+// returnNew is set. v may be nil when only the update is of interest.
+// ErrNotFound is returned when nothing matched
+func (db *DB) FindOneAndUpdate(coll string, query, update interface{},
+	returnNew bool, v interface{}) error {
+	var isUpdate, err = hasOperators(update)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", coll, ErrInvalidQuery, err)
+	}
+
+	if !isUpdate {
+		return fmt.Errorf("%s: %w: update without operators", coll, ErrInvalidQuery)
+	}
+
+	var opts = findOneAndUpdateOptions(db.maxTime(coll), returnNew)
+
+	var o = &Op{Name: "findOneAndUpdate", Collection: coll, Query: query, Result: v, IDs: queryIDs(query)}
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		return decodeResult(c.FindOneAndUpdate(ctx, filter(query), update, opts,
+			&options.FindOneAndUpdateOptions{Comment: commentValue(ctx)}), v)
+	})
+}
+
+// findOneAndUpdateOptions returns the options of FindOneAndUpdate, which
+// never upserts
+func findOneAndUpdateOptions(maxTime time.Duration, returnNew bool) *options.FindOneAndUpdateOptions {
+	var opts = options.FindOneAndUpdate().SetMaxTime(maxTime)
+	if returnNew {
+		opts.SetReturnDocument(options.After)
+	}
+
+	return opts
+}
+
+func decodeResult(res *mongo.SingleResult, v interface{}) error {
+	if v == nil {
+		return res.Err()
+	}
+
+	return res.Decode(v)
+}
+
+// FindOneAndDelete atomically removes the first document matching query and
+// decodes it into v. ErrNotFound is returned when nothing matched
+func (db *DB) FindOneAndDelete(coll string, query interface{}, v interface{}) error {
+	var opts = options.FindOneAndDelete().SetMaxTime(db.maxTime(coll))
+
+	var o = &Op{Name: "findOneAndDelete", Collection: coll, Query: query, Result: v, IDs: queryIDs(query)}
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		return decodeResult(c.FindOneAndDelete(ctx, filter(query), opts,
+			&options.FindOneAndDeleteOptions{Comment: commentValue(ctx)}), v)
+	})
+}
+
+// FindOneAndReplace atomically replaces the first document matching query
+// with doc and decodes the previous document into v, or the new one if
+// returnNew is set. ErrNotFound is returned when nothing matched
+func (db *DB) FindOneAndReplace(coll string, query, doc interface{},
+	returnNew bool, v interface{}) error {
+	var isUpdate, err = hasOperators(doc)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", coll, ErrInvalidQuery, err)
+	}
+
+	if isUpdate {
+		return fmt.Errorf("%s: %w: replacement with operators", coll, ErrInvalidQuery)
+	}
+
+	var opts = findOneAndReplaceOptions(db.maxTime(coll), returnNew)
+
+	var o = &Op{Name: "findOneAndReplace", Collection: coll, Query: query, Result: v, IDs: queryIDs(query)}
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		return decodeResult(c.FindOneAndReplace(ctx, filter(query), doc, opts,
+			&options.FindOneAndReplaceOptions{Comment: commentValue(ctx)}), v)
+	})
+}
+
+// findOneAndReplaceOptions returns the options of FindOneAndReplace
+func findOneAndReplaceOptions(maxTime time.Duration, returnNew bool) *options.FindOneAndReplaceOptions {
+	var opts = options.FindOneAndReplace().SetMaxTime(maxTime)
+	if returnNew {
+		opts.SetReturnDocument(options.After)
+	}
+
+	return opts
+}
+
+// Increment atomically adds delta to the numeric field of the document with
+// id and returns the new value, e.g. for statistics counters. A missing
+// document is created with field set to delta
+func (db *DB) Increment(coll string, id interface{}, field string, delta int64) (int64, error) {
+	if !validField(field) || field == "_id" {
+		return 0, fmt.Errorf("%s: %w: %q can't be incremented", coll, ErrInvalidQuery, field)
+	}
+
+	var (
+		doc  bson.Raw
+		opts = options.FindOneAndUpdate().
+			SetMaxTime(db.maxTime(coll)).
+			SetUpsert(true).
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{field: 1})
+		query = bson.M{"_id": id}
+		o     = &Op{Name: "findOneAndUpdate", Collection: coll, Query: query, Result: &doc, IDs: []interface{}{id}}
+	)
+
+	var err = db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		return decodeResult(c.FindOneAndUpdate(ctx, query, bson.M{"$inc": bson.M{field: delta}}, opts,
+			&options.FindOneAndUpdateOptions{Comment: commentValue(ctx)}), &doc)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n, ok = doc.Lookup(strings.Split(field, ".")...).AsInt64OK()
+	if !ok {
+		return 0, fmt.Errorf("%s: %s is not a number", coll, field)
+	}
+
+	return n, nil
+}
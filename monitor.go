@@ -0,0 +1,215 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	minProbeBackoff = 500 * time.Millisecond
+	maxProbeBackoff = 30 * time.Second
+)
+
+// monitor follows the availability of the deployment of one client. The
+// driver replaces broken connections by itself, while the primary is
+// unreachable monitor pings it with exponential backoff so that recovery is
+// noticed sooner than the regular heartbeat would. Changes are reported to
+// the hooks while the client is in use
+type monitor struct {
+	sync.Mutex
+
+	up        bool
+	connected bool
+	active    bool
+	announced bool
+	downSince time.Time
+	stop      chan struct{}
+	hooks     *hooks
+}
+
+// hooks are the connection callbacks and the logger, shared by a DB and
+// its handles
+type hooks struct {
+	sync.Mutex
+
+	db         *DB
+	log        Logger
+	debug      bool
+	middleware []Middleware
+
+	onConnect    []func(db *DB)
+	onDisconnect []func()
+	onReconnect  []func(downtime time.Duration)
+	onAudit      []func(AuditEvent)
+}
+
+func newMonitor(h *hooks) *monitor {
+	return &monitor{stop: make(chan struct{}), hooks: h}
+}
+
+func (db *DB) callbacks() *hooks {
+	if db.hooks == nil {
+		db.hooks = &hooks{db: db}
+	}
+
+	return db.hooks
+}
+
+// WithConnectHook calls fn whenever a connection is established and in use,
+// on the initial connect as well as after Reconnect or a failover, e.g. to
+// ensure indexes. fn gets the DB the hook was registered for
+func WithConnectHook(fn func(db *DB)) Option {
+	return func(db *DB) {
+		var h = db.callbacks()
+
+		h.onConnect = append(h.onConnect, fn)
+	}
+}
+
+// WithDisconnectHook calls fn whenever the primary of the connection in use
+// becomes unreachable, Disconnect doesn't call it
+func WithDisconnectHook(fn func()) Option {
+	return func(db *DB) {
+		var h = db.callbacks()
+
+		h.onDisconnect = append(h.onDisconnect, fn)
+	}
+}
+
+// WithReconnectHook calls fn with the duration of the outage whenever the
+// primary becomes reachable again after it was lost
+func WithReconnectHook(fn func(downtime time.Duration)) Option {
+	return func(db *DB) {
+		var h = db.callbacks()
+
+		h.onReconnect = append(h.onReconnect, fn)
+	}
+}
+
+func (m *monitor) serverMonitor(client func() *mongo.Client) *event.ServerMonitor {
+	return &event.ServerMonitor{
+		// runs with the topology locked, so nothing here may select a server
+		TopologyDescriptionChanged: func(ev *event.TopologyDescriptionChangedEvent) {
+			m.changed(ev.NewDescription.HasWritableServer(), client)
+		},
+	}
+}
+
+func (m *monitor) close() {
+	m.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.active = false
+	m.Unlock()
+}
+
+// activate is called once the client is in use, from then on changes are
+// reported
+func (m *monitor) activate() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.active = true
+	m.announce()
+}
+
+// announce calls the connect hooks once the client is in use and reached
+func (m *monitor) announce() {
+	if !m.active || !m.connected || m.announced {
+		return
+	}
+
+	m.announced = true
+
+	m.hooks.logger().Debugf("mongo: connected")
+
+	for _, fn := range m.hooks.onConnect {
+		go fn(m.hooks.db)
+	}
+}
+
+func (m *monitor) changed(up bool, client func() *mongo.Client) {
+	m.Lock()
+	defer m.Unlock()
+
+	if up == m.up {
+		return
+	}
+
+	m.up = up
+
+	if !up {
+		m.downSince = time.Now()
+
+		if m.stop != nil {
+			go m.probe(client, m.stop)
+		}
+
+		if m.announced && m.active {
+			m.hooks.logger().Warnf("mongo: primary lost")
+
+			for _, fn := range m.hooks.onDisconnect {
+				go fn()
+			}
+		}
+
+		return
+	}
+
+	if !m.connected {
+		m.connected = true
+		m.announce()
+		return
+	}
+
+	if !m.announced || !m.active {
+		return
+	}
+
+	var downtime = time.Since(m.downSince)
+
+	m.hooks.logger().Warnf("mongo: primary reachable again after %v", downtime)
+
+	for _, fn := range m.hooks.onReconnect {
+		go fn(downtime)
+	}
+}
+
+func (m *monitor) isUp() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.up
+}
+
+func (m *monitor) probe(client func() *mongo.Client, stop chan struct{}) {
+	var backoff = minProbeBackoff
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		if m.isUp() {
+			return
+		}
+
+		if c := client(); c != nil {
+			var ctx, cancel = context.WithTimeout(context.Background(), backoff)
+			_ = c.Ping(ctx, nil)
+			cancel()
+		}
+
+		if backoff *= 2; backoff > maxProbeBackoff {
+			backoff = maxProbeBackoff
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Option configures a DB created by NewConnection
+type Option func(*DB)
+
+// invalid records a mistake in the options, NewConnection returns it
+// instead of connecting
+func (db *DB) invalid(err error) {
+	db.optErr = errors.Join(db.optErr, err)
+}
+
+// WithTimeout sets the connection timeout, values under a second fall back
+// to the default of 15 seconds
+func WithTimeout(d time.Duration) Option {
+	return func(db *DB) {
+		db.timeout = d
+	}
+}
+
+// WithMaxTimeMS sets the server-side time limit for queries
+func WithMaxTimeMS(d time.Duration) Option {
+	return func(db *DB) {
+		db.maxTimeMS = d
+	}
+}
+
+// WithLazyConnect makes NewConnection return without waiting for the
+// server, the connection is established in the background. Until it is up
+// every operation keeps retrying to select a server for up to the
+// connection timeout before failing, so a service can start before MongoDB
+// and becomes functional once it is reachable. Invalid DSNs still fail
+func WithLazyConnect() Option {
+	return func(db *DB) {
+		db.lazy = true
+	}
+}
+
+// WithDialRetry makes NewConnection retry an unreachable deployment with
+// exponential backoff for up to d instead of failing on the first attempt,
+// e.g. when the service starts before MongoDB. Invalid DSNs still fail
+func WithDialRetry(d time.Duration) Option {
+	return func(db *DB) {
+		db.dialRetry = d
+	}
+}
+
+// WithDatabase selects the database instead of the one named in the DSN
+func WithDatabase(name string) Option {
+	return func(db *DB) {
+		db.database = name
+	}
+}
+
+// WithPoolLimit limits the number of connections per server, 100 by
+// default. Operations wait for a free connection up to their own timeout
+func WithPoolLimit(n int) Option {
+	return poolOption("pool limit", n, options.Client().SetMaxPoolSize)
+}
+
+// WithMinPoolSize keeps at least n connections per server open
+func WithMinPoolSize(n int) Option {
+	return poolOption("minimum pool size", n, options.Client().SetMinPoolSize)
+}
+
+// WithMaxConnIdleTime closes connections idle in the pool for longer than d
+func WithMaxConnIdleTime(d time.Duration) Option {
+	return WithClientOptions(options.Client().SetMaxConnIdleTime(d))
+}
+
+// WithMaxConnecting limits how many connections a pool establishes
+// concurrently, 2 by default
+func WithMaxConnecting(n int) Option {
+	return poolOption("connecting limit", n, options.Client().SetMaxConnecting)
+}
+
+// poolOption sets the pool size name to n with set, a negative n would
+// wrap around to no limit at all
+func poolOption(name string, n int, set func(uint64) *options.ClientOptions) Option {
+	return func(db *DB) {
+		if n < 0 {
+			db.invalid(fmt.Errorf("%s %d is negative", name, n))
+			return
+		}
+
+		WithClientOptions(set(uint64(n)))(db)
+	}
+}
+
+// WithSocketTimeout bounds each socket read and write, by default only the
+// operation timeout applies
+func WithSocketTimeout(d time.Duration) Option {
+	return WithClientOptions(options.Client().SetSocketTimeout(d))
+}
+
+// WithReadPreference sets the default read preference of the connection
+func WithReadPreference(rp *readpref.ReadPref) Option {
+	return WithClientOptions(options.Client().SetReadPreference(rp))
+}
+
+// WithAppName sets the application name reported to the server
+func WithAppName(name string) Option {
+	return WithClientOptions(options.Client().SetAppName(name))
+}
+
+// WithClientOptions applies raw driver options on top of the ones parsed
+// from the DSN
+func WithClientOptions(opts *options.ClientOptions) Option {
+	return func(db *DB) {
+		db.clientOpts = append(db.clientOpts, opts)
+	}
+}
+
+// Compressors for WithCompression
+const (
+	CompressorSnappy = "snappy"
+	CompressorZlib   = "zlib"
+	CompressorZstd   = "zstd"
+)
+
+// WithCompression compresses the traffic with the first of compressors the
+// server supports as well, e.g. WithCompression(CompressorZstd, CompressorSnappy)
+func WithCompression(compressors ...string) Option {
+	return WithClientOptions(options.Client().SetCompressors(compressors))
+}
@@ -0,0 +1,373 @@
+package mongo
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ParamType selects how the values of a filter parameter are parsed
+type ParamType int
+
+const (
+	ParamString ParamType = iota
+	ParamInt
+	ParamFloat
+	ParamBool
+	// ParamTime is RFC 3339, e.g. 2024-05-01T12:00:00Z
+	ParamTime
+	ParamObjectID
+)
+
+// paramOperators are the operators FilterParams can allow
+var paramOperators = map[string]bool{
+	"ne": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"in": true, "nin": true, "exists": true,
+}
+
+var filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([a-z]+)\])?$`)
+
+// FilterParams translates the query parameters of a REST request into a
+// filter and FindOptions, e.g.
+//
+//	filter[status]=active&filter[age][gte]=18&filter[type][in]=ap,switch&sort=-created,name&limit=50&offset=100
+//
+// Only the listed fields and operators are accepted, anything else fails
+// with ErrInvalidQuery, so that requests can't inject operators
+type FilterParams struct {
+	// Fields that may be filtered and sorted by, with the type of their
+	// values
+	Fields map[string]ParamType
+
+	// Operators allowed besides equality: ne, gt, gte, lt, lte, in, nin and
+	// exists. Values of in and nin are separated by commas
+	Operators []string
+
+	// DefaultLimit applies without a limit parameter, MaxLimit caps it.
+	// Zero leaves them unlimited
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Parse returns the filter and FindOptions of the parameters in values,
+// other parameters are ignored. Each parameter may be given once
+func (p *FilterParams) Parse(values url.Values) (bson.M, *FindOptions, error) {
+	var (
+		q    = Q()
+		opts = &FindOptions{Limit: p.DefaultLimit}
+	)
+
+	// Get would take the first of repeated parameters and drop the others
+	for key, vs := range values {
+		var ours = key == "sort" || key == "limit" || key == "offset" || filterParam.MatchString(key)
+
+		if ours && len(vs) > 1 {
+			return nil, nil, fmt.Errorf("%w: %s given %d times", ErrInvalidQuery, key, len(vs))
+		}
+	}
+
+	for key := range values {
+		var m = filterParam.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+
+		var field, op, value = m[1], m[2], values.Get(key)
+
+		if err := p.filter(q, field, op, value); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, key, err)
+		}
+	}
+
+	if s := values.Get("sort"); s != "" {
+		var sort, err = parseSort(s, p.sortable)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: sort: %v", ErrInvalidQuery, err)
+		}
+
+		opts.Sort = sort
+	}
+
+	for _, param := range []struct {
+		name string
+		n    *int
+	}{{"limit", &opts.Limit}, {"offset", &opts.Skip}} {
+		var s = values.Get(param.name)
+		if s == "" {
+			continue
+		}
+
+		var n, err = strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, nil, fmt.Errorf("%w: %s %q is not a count", ErrInvalidQuery, param.name, s)
+		}
+
+		*param.n = n
+	}
+
+	if p.MaxLimit > 0 && (opts.Limit == 0 || opts.Limit > p.MaxLimit) {
+		opts.Limit = p.MaxLimit
+	}
+
+	return q.M(), opts, nil
+}
+
+func (p *FilterParams) sortable(field string) bool {
+	var _, ok = p.Fields[field]
+
+	return ok
+}
+
+func (p *FilterParams) filter(q *Query, field, op, value string) error {
+	var typ, ok = p.Fields[field]
+	if !ok {
+		return fmt.Errorf("unknown field")
+	}
+
+	if op == "" {
+		var v, err = parseParam(typ, value)
+		if err != nil {
+			return err
+		}
+
+		q.Eq(field, v)
+
+		return nil
+	}
+
+	if !p.allowed(op) {
+		return fmt.Errorf("operator %s not allowed", op)
+	}
+
+	switch op {
+	case "exists":
+		var v, err = strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		q.Exists(field, v)
+	case "in", "nin":
+		var list = []interface{}{}
+
+		for _, s := range strings.Split(value, ",") {
+			var v, err = parseParam(typ, s)
+			if err != nil {
+				return err
+			}
+
+			list = append(list, v)
+		}
+
+		q.op(field, "$"+op, list)
+	default:
+		var v, err = parseParam(typ, value)
+		if err != nil {
+			return err
+		}
+
+		q.op(field, "$"+op, v)
+	}
+
+	return nil
+}
+
+func (p *FilterParams) allowed(op string) bool {
+	if !paramOperators[op] {
+		return false
+	}
+
+	for _, allowed := range p.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseParam(typ ParamType, s string) (interface{}, error) {
+	switch typ {
+	case ParamInt:
+		return strconv.ParseInt(s, 10, 64)
+	case ParamFloat:
+		return strconv.ParseFloat(s, 64)
+	case ParamBool:
+		return strconv.ParseBool(s)
+	case ParamTime:
+		return time.Parse(time.RFC3339, s)
+	case ParamObjectID:
+		return primitive.ObjectIDFromHex(s)
+	}
+
+	return s, nil
+}
+
+// ParseSort validates a user supplied sort expression, a comma separated
+// list of fields in mgo notation, e.g. "-created_at,name", and returns its
+// fields in order for FindOptions.Sort. Fields must be among allowed unless
+// it is empty, names starting with $ or with empty path elements are
+// rejected either way with ErrInvalidQuery
+func ParseSort(s string, allowed ...string) ([]string, error) {
+	var fields, err = parseSort(s, func(field string) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+
+		for _, a := range allowed {
+			if a == field {
+				return true
+			}
+		}
+
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: sort: %v", ErrInvalidQuery, err)
+	}
+
+	return fields, nil
+}
+
+// parseSort splits a sort expression and rejects fields that are not
+// allowed
+func parseSort(s string, allowed func(field string) bool) ([]string, error) {
+	var fields []string
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		var name = strings.TrimLeft(field, "+-")
+		if len(field)-len(name) > 1 || !validField(name) {
+			return nil, fmt.Errorf("%q is not a sort field", field)
+		}
+
+		if !allowed(name) {
+			return nil, fmt.Errorf("field %s not allowed", name)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// validField reports whether name is a plain field path, e.g. "radio.band"
+func validField(name string) bool {
+	if name == "" || strings.HasPrefix(name, "$") || strings.ContainsAny(name, " \t\x00") {
+		return false
+	}
+
+	for _, elem := range strings.Split(name, ".") {
+		if elem == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SanitizeFilter checks a filter from an untrusted source, e.g. a decoded
+// JSON body, and returns it as a document. It fails with ErrInvalidQuery if
+// a key at any depth contains $, so that no operators like $where or $ne
+// can be injected, or if a nested key contains a dot. Dotted keys at the
+// top refer to nested fields and are kept
+func SanitizeFilter(filter map[string]interface{}) (bson.M, error) {
+	var m = bson.M{}
+
+	for key, v := range filter {
+		if err := sanitize(key, v, true); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+
+		m[key] = v
+	}
+
+	return m, nil
+}
+
+// sanitizeQuery is SanitizeFilter for the filters Find takes, maps and
+// bson.D. Other filters are built in code, not decoded from a request, and
+// are rejected so that they aren't passed unchecked
+func sanitizeQuery(query interface{}) (interface{}, error) {
+	switch q := query.(type) {
+	case nil:
+		return bson.M{}, nil
+	case map[string]interface{}:
+		return SanitizeFilter(q)
+	case bson.M:
+		return SanitizeFilter(q)
+	case bson.D:
+		for _, e := range q {
+			if err := sanitize(e.Key, e.Value, true); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+			}
+		}
+
+		return q, nil
+	}
+
+	return nil, fmt.Errorf("%w: filter of type %T can't be sanitized", ErrInvalidQuery, query)
+}
+
+func sanitize(key string, v interface{}, top bool) error {
+	if strings.Contains(key, "$") {
+		return fmt.Errorf("operator in key %q", key)
+	}
+
+	if !top && strings.Contains(key, ".") {
+		return fmt.Errorf("dot in nested key %q", key)
+	}
+
+	var check = func(key string, v interface{}) error { return sanitize(key, v, false) }
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if err := check(k, elem); err != nil {
+				return err
+			}
+		}
+	case bson.M:
+		for k, elem := range v {
+			if err := check(k, elem); err != nil {
+				return err
+			}
+		}
+	case bson.D:
+		for _, e := range v {
+			if err := check(e.Key, e.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if err := sanitize("", elem, false); err != nil {
+				return err
+			}
+		}
+	case bson.A:
+		for _, elem := range v {
+			if err := sanitize("", elem, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WithFilterSanitizing checks the filters passed to Find with
+// SanitizeFilter, for services that take them from request bodies. Use the
+// typed methods for filters with operators
+func WithFilterSanitizing() Option {
+	return func(db *DB) {
+		db.sanitize = true
+	}
+}
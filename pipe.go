@@ -0,0 +1,212 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PipeOptions for PipeWithOptions and PipeOneWithOptions, zero values are
+// left unset
+type PipeOptions struct {
+	// Hint forces an index for the initial $match, by name or key document
+	Hint interface{}
+
+	Collation *Collation
+}
+
+func (o *PipeOptions) aggregate() *options.AggregateOptions {
+	var opts = options.Aggregate()
+	if o == nil {
+		return opts
+	}
+
+	if o.Hint != nil {
+		opts.SetHint(o.Hint)
+	}
+
+	if o.Collation != nil {
+		opts.SetCollation(o.Collation)
+	}
+
+	return opts
+}
+
+// PipeWithOptions runs the aggregation query and decodes all results into
+// v, opts may be nil
+func (db *DB) PipeWithOptions(coll string, query interface{}, v interface{},
+	opts *PipeOptions) error {
+	return db.pipeAll(coll, query, opts.aggregate(), v)
+}
+
+// PipeOneWithOptions runs the aggregation query and decodes the first result
+// into v, opts may be nil
+func (db *DB) PipeOneWithOptions(coll string, query interface{}, v interface{},
+	opts *PipeOptions) error {
+	return db.pipeOne(coll, query, opts.aggregate(), v)
+}
+
+// MergeOptions make PipeTo merge the results into the target collection
+// with $merge instead of replacing it, zero values use the server defaults
+type MergeOptions struct {
+	// On are the fields identifying a matching document, _id by default.
+	// They need a unique index in the target collection
+	On []string
+
+	// WhenMatched is "replace", "keepExisting", "merge" (the default) or
+	// "fail"
+	WhenMatched string
+
+	// WhenNotMatched is "insert" (the default), "discard" or "fail"
+	WhenNotMatched string
+}
+
+func (o *MergeOptions) stage(target string) bson.M {
+	var spec = bson.M{"into": target}
+
+	if len(o.On) > 0 {
+		spec["on"] = o.On
+	}
+
+	if o.WhenMatched != "" {
+		spec["whenMatched"] = o.WhenMatched
+	}
+
+	if o.WhenNotMatched != "" {
+		spec["whenNotMatched"] = o.WhenNotMatched
+	}
+
+	return bson.M{"$merge": spec}
+}
+
+// PipeTo runs the aggregation query and writes the results to target on the
+// server, e.g. for nightly rollups. With merge nil target is replaced with
+// $out, otherwise the results are merged into it with $merge
+func (db *DB) PipeTo(coll string, query interface{}, target string, merge *MergeOptions) error {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var stage = bson.M{"$out": target}
+	if merge != nil {
+		stage = merge.stage(target)
+	}
+
+	pipeline = append(pipeline, stage)
+
+	var o = &Op{Name: "pipeTo", Collection: coll, Query: pipeline}
+
+	// replacing target again has the same result, merging may not
+	return db.write(o, merge == nil, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Aggregate(ctx, pipeline, db.pipeOptions(coll, options.Aggregate()),
+			&options.AggregateOptions{Comment: comment(ctx)})
+		if err != nil {
+			return err
+		}
+
+		return cur.Close(ctx)
+	})
+}
+
+// MapReduce is a map-reduce job for DB.MapReduce, as in mgo. The functions
+// are JavaScript source. Prefer pipelines, the server deprecated map-reduce
+type MapReduce struct {
+	Map      string
+	Reduce   string
+	Finalize string
+
+	// Scope are global variables of the functions
+	Scope interface{}
+
+	// Out is nil to return the results inline, the name of a collection to
+	// replace with them, or a document like M{"merge": "totals"}
+	Out interface{}
+
+	// Sort and Limit the input documents, Sort in mgo notation
+	Sort  []string
+	Limit int
+}
+
+// MapReduce runs job over the documents of coll matching query. Inline
+// results are decoded into v, which may be nil when job.Out is set
+func (db *DB) MapReduce(coll string, query interface{}, job *MapReduce, v interface{}) error {
+	if job == nil || job.Map == "" || job.Reduce == "" {
+		return fmt.Errorf("%s: %w: map-reduce needs map and reduce functions", coll, ErrInvalidQuery)
+	}
+
+	var o = &Op{Name: "mapReduce", Collection: coll, Query: query, Result: v}
+
+	return db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var res struct {
+			Results bson.RawValue `bson:"results"`
+		}
+
+		var cmd = mapReduceCommand(coll, query, job, db.maxTime(coll), commentValue(ctx))
+
+		if err := c.Database().RunCommand(ctx, cmd).Decode(&res); err != nil {
+			return err
+		}
+
+		if v == nil || job.Out != nil {
+			return nil
+		}
+
+		if err := res.Results.Unmarshal(v); err != nil {
+			return err
+		}
+
+		o.N = docs(v)
+
+		return nil
+	})
+}
+
+// mapReduceCommand returns the command running job, bounded by maxTime like
+// other queries and tagged with the comment of the context if not nil
+func mapReduceCommand(coll string, query interface{}, job *MapReduce, maxTime time.Duration, comment interface{}) bson.D {
+	var cmd = bson.D{
+		{Key: "mapReduce", Value: coll},
+		{Key: "map", Value: primitive.JavaScript(job.Map)},
+		{Key: "reduce", Value: primitive.JavaScript(job.Reduce)},
+		{Key: "query", Value: filter(query)},
+	}
+
+	if job.Finalize != "" {
+		cmd = append(cmd, bson.E{Key: "finalize", Value: primitive.JavaScript(job.Finalize)})
+	}
+
+	if job.Scope != nil {
+		cmd = append(cmd, bson.E{Key: "scope", Value: job.Scope})
+	}
+
+	if len(job.Sort) > 0 {
+		cmd = append(cmd, bson.E{Key: "sort", Value: sortFields(job.Sort...)})
+	}
+
+	if job.Limit > 0 {
+		cmd = append(cmd, bson.E{Key: "limit", Value: job.Limit})
+	}
+
+	var out = job.Out
+	if out == nil {
+		out = bson.M{"inline": 1}
+	}
+
+	cmd = append(cmd, bson.E{Key: "out", Value: out})
+
+	if maxTime > 0 {
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: maxTime.Milliseconds()})
+	}
+
+	if comment != nil {
+		cmd = append(cmd, bson.E{Key: "comment", Value: comment})
+	}
+
+	return cmd
+}
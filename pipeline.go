@@ -0,0 +1,215 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PipelineBuilder builds an aggregation pipeline for Pipe and PipeOne, e.g.
+//
+//	Pipeline().
+//		Match(Q().Eq("status", "active")).
+//		Group("$site", M{"n": M{"$sum": 1}}).
+//		Sort("-n").
+//		Limit(10)
+//
+// Mistakes are collected and reported by Build
+type PipelineBuilder struct {
+	stages []bson.M
+	errs   []error
+}
+
+// Pipeline starts an empty pipeline
+func Pipeline() *PipelineBuilder {
+	return &PipelineBuilder{}
+}
+
+// Stage appends a stage of any kind, e.g. Stage("$sample", M{"size": 5})
+func (p *PipelineBuilder) Stage(name string, spec interface{}) *PipelineBuilder {
+	if !strings.HasPrefix(name, "$") {
+		p.fail("stage %q doesn't start with $", name)
+	}
+
+	p.stages = append(p.stages, bson.M{name: spec})
+
+	return p
+}
+
+func (p *PipelineBuilder) fail(format string, args ...interface{}) {
+	p.errs = append(p.errs, fmt.Errorf("%w: stage %d: %s", ErrInvalidQuery,
+		len(p.stages)+1, fmt.Sprintf(format, args...)))
+}
+
+// Match keeps the documents matching query, e.g. a Query. An empty query
+// matches all documents and adds no stage
+func (p *PipelineBuilder) Match(query interface{}) *PipelineBuilder {
+	// an empty document takes 5 bytes
+	if raw, err := bson.Marshal(filter(query)); err == nil && len(raw) == 5 {
+		return p
+	}
+
+	return p.Stage("$match", filter(query))
+}
+
+// Group groups the documents by id, e.g. "$site" or D{{"site", "$site"},
+// {"day", ...}}, and computes fields with accumulators, e.g.
+// M{"total": M{"$sum": "$bytes"}}. The output has the fields in the order of
+// a D, or sorted by name
+func (p *PipelineBuilder) Group(id interface{}, fields interface{}) *PipelineBuilder {
+	var spec = bson.D{{Key: "_id", Value: id}}
+
+	switch fields := fields.(type) {
+	case bson.M:
+		var names = make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			spec = append(spec, bson.E{Key: name, Value: fields[name]})
+		}
+	case bson.D:
+		spec = append(spec, fields...)
+	case nil:
+	default:
+		p.fail("group fields are a %T, not a document", fields)
+	}
+
+	for _, e := range spec[1:] {
+		var n int
+
+		switch doc := e.Value.(type) {
+		case bson.M:
+			n = len(doc)
+		case bson.D:
+			n = len(doc)
+		}
+
+		if e.Key == "_id" || n != 1 {
+			p.fail("group field %q is not a single accumulator", e.Key)
+		}
+	}
+
+	return p.Stage("$group", spec)
+}
+
+// Sort orders the documents by fields in mgo notation, e.g. "-created"
+func (p *PipelineBuilder) Sort(fields ...string) *PipelineBuilder {
+	if len(fields) == 0 {
+		p.fail("sort without fields")
+	}
+
+	return p.Stage("$sort", sortFields(fields...))
+}
+
+// Skip drops the first n documents
+func (p *PipelineBuilder) Skip(n int) *PipelineBuilder {
+	if n < 0 {
+		p.fail("negative skip %d", n)
+	}
+
+	return p.Stage("$skip", n)
+}
+
+// Limit passes on the first n documents
+func (p *PipelineBuilder) Limit(n int) *PipelineBuilder {
+	if n <= 0 {
+		p.fail("limit %d is not positive", n)
+	}
+
+	return p.Stage("$limit", n)
+}
+
+// Project reshapes the documents, e.g. M{"name": 1, "_id": 0}
+func (p *PipelineBuilder) Project(projection interface{}) *PipelineBuilder {
+	return p.Stage("$project", projection)
+}
+
+// AddFields adds computed fields to the documents
+func (p *PipelineBuilder) AddFields(fields interface{}) *PipelineBuilder {
+	return p.Stage("$addFields", fields)
+}
+
+// Unwind outputs a document per element of the array at path, e.g. "tags"
+func (p *PipelineBuilder) Unwind(path string) *PipelineBuilder {
+	return p.Stage("$unwind", fieldPath(path))
+}
+
+// fieldPath refers to the value of field in expressions, e.g. "$site"
+func fieldPath(field string) string {
+	if strings.HasPrefix(field, "$") {
+		return field
+	}
+
+	return "$" + field
+}
+
+// Lookup joins the documents of from whose foreignField equals localField
+// as the array as
+func (p *PipelineBuilder) Lookup(from, localField, foreignField, as string) *PipelineBuilder {
+	return p.Stage("$lookup", bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": foreignField,
+		"as":           as,
+	})
+}
+
+// Count outputs a single document with the number of documents as field
+func (p *PipelineBuilder) Count(field string) *PipelineBuilder {
+	if field == "" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		p.fail("count field %q is not a plain name", field)
+	}
+
+	return p.Stage("$count", field)
+}
+
+// Build returns the stages, or the mistakes made building them wrapping
+// ErrInvalidQuery
+func (p *PipelineBuilder) Build() ([]bson.M, error) {
+	var errs = p.errs
+
+	for i, stage := range p.stages {
+		for name := range stage {
+			if (name == "$out" || name == "$merge") && i != len(p.stages)-1 {
+				errs = append(errs, fmt.Errorf("%w: stage %d: %s must be the last stage",
+					ErrInvalidQuery, i+1, name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return append([]bson.M{}, p.stages...), nil
+}
+
+// stages returns the stages of a pipeline, e.g. a []bson.M, []bson.D or
+// mongo.Pipeline, nil is empty. A single document is rejected with
+// ErrInvalidQuery
+func stages(pipeline interface{}) ([]interface{}, error) {
+	if pipeline == nil {
+		return []interface{}{}, nil
+	}
+
+	var v = reflect.ValueOf(pipeline)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array ||
+		v.Type() == reflect.TypeOf(bson.D{}) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, fmt.Errorf("%w: pipeline is a %T, not a list of stages", ErrInvalidQuery, pipeline)
+	}
+
+	var list = make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+
+	return list, nil
+}
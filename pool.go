@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// PoolStats is a snapshot of the connection pools of all servers
+type PoolStats struct {
+	// Open connections, in use or idle
+	Open int `json:"open"`
+
+	// InUse are the connections checked out by operations
+	InUse int `json:"inUse"`
+
+	// Idle are the open connections available to operations
+	Idle int `json:"idle"`
+
+	// Waiting is the number of operations waiting for a connection, it
+	// grows when the pool limit is reached, see WithPoolLimit
+	Waiting int `json:"waiting"`
+
+	// CheckOuts counts the connection requests of operations so far,
+	// CheckOutFailures those that failed, e.g. because no connection
+	// became available in time
+	CheckOuts        int64 `json:"checkOuts"`
+	CheckOutFailures int64 `json:"checkOutFailures"`
+}
+
+// poolStats counts the pool events of a client
+type poolStats struct {
+	open, inUse, waiting        int64
+	checkOuts, checkOutFailures int64
+}
+
+// poolMonitor counts the events and passes them on to next, the monitor
+// set with WithClientOptions if any
+func (p *poolStats) poolMonitor(next *event.PoolMonitor) *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(ev *event.PoolEvent) {
+			if next != nil && next.Event != nil {
+				next.Event(ev)
+			}
+
+			switch ev.Type {
+			case event.ConnectionCreated:
+				atomic.AddInt64(&p.open, 1)
+			case event.ConnectionClosed:
+				atomic.AddInt64(&p.open, -1)
+			case event.GetStarted:
+				atomic.AddInt64(&p.waiting, 1)
+				atomic.AddInt64(&p.checkOuts, 1)
+			case event.GetSucceeded:
+				atomic.AddInt64(&p.waiting, -1)
+				atomic.AddInt64(&p.inUse, 1)
+			case event.GetFailed:
+				atomic.AddInt64(&p.waiting, -1)
+				atomic.AddInt64(&p.checkOutFailures, 1)
+			case event.ConnectionReturned:
+				atomic.AddInt64(&p.inUse, -1)
+			}
+		},
+	}
+}
+
+func (p *poolStats) snapshot() PoolStats {
+	var s = PoolStats{
+		Open:             int(atomic.LoadInt64(&p.open)),
+		InUse:            int(atomic.LoadInt64(&p.inUse)),
+		Waiting:          int(atomic.LoadInt64(&p.waiting)),
+		CheckOuts:        atomic.LoadInt64(&p.checkOuts),
+		CheckOutFailures: atomic.LoadInt64(&p.checkOutFailures),
+	}
+
+	if s.Idle = s.Open - s.InUse; s.Idle < 0 {
+		s.Idle = 0
+	}
+
+	return s
+}
+
+// poolMonitor returns the pool monitor set with WithClientOptions
+func (db *DB) poolMonitor() *event.PoolMonitor {
+	var m *event.PoolMonitor
+
+	for _, opts := range db.clientOpts {
+		if opts.PoolMonitor != nil {
+			m = opts.PoolMonitor
+		}
+	}
+
+	return m
+}
+
+// Stats returns the state of the connection pools, e.g. to alert before
+// operations start to time out waiting for a connection. It is zero when
+// not connected
+func (db *DB) Stats() PoolStats {
+	var c = db.link.current()
+	if c == nil {
+		return PoolStats{}
+	}
+
+	return c.pool.snapshot()
+}
@@ -0,0 +1,88 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProfilingLevel selects the operations the database profiler records
+type ProfilingLevel int
+
+const (
+	ProfileOff ProfilingLevel = iota
+	// ProfileSlow records operations slower than the threshold
+	ProfileSlow
+	ProfileAll
+)
+
+// profileColl holds the operations recorded by the profiler
+const profileColl = "system.profile"
+
+// ProfileEntry is an operation recorded by the database profiler
+type ProfileEntry struct {
+	Op           string    `bson:"op"`
+	Namespace    string    `bson:"ns"`
+	Command      bson.M    `bson:"command"`
+	Millis       int64     `bson:"millis"`
+	PlanSummary  string    `bson:"planSummary"`
+	KeysExamined int64     `bson:"keysExamined"`
+	DocsExamined int64     `bson:"docsExamined"`
+	Returned     int64     `bson:"nreturned"`
+	Client       string    `bson:"client"`
+	AppName      string    `bson:"appName"`
+	User         string    `bson:"user"`
+	Timestamp    time.Time `bson:"ts"`
+}
+
+// SetProfilingLevel enables the profiler of the database, with ProfileSlow
+// operations slower than slow are recorded
+func (db *DB) SetProfilingLevel(level ProfilingLevel, slow time.Duration) error {
+	var (
+		res bson.M
+		cmd = bson.D{{Key: "profile", Value: int(level)}}
+	)
+
+	if slow > 0 {
+		cmd = append(cmd, bson.E{Key: "slowms", Value: slow.Milliseconds()})
+	}
+
+	return db.exec(&Op{Name: "profile", Collection: profileColl}, func(ctx context.Context, c *mongo.Collection) error {
+		return c.Database().RunCommand(ctx, cmd).Decode(&res)
+	})
+}
+
+// ReadProfile returns the operations recorded by the profiler that match
+// query, latest first, e.g. M{"millis": M{"$gt": 100}}. query may be nil
+func (db *DB) ReadProfile(query interface{}) ([]ProfileEntry, error) {
+	var (
+		entries = []ProfileEntry{}
+		o       = &Op{Name: "find", Collection: profileColl, Query: query, Result: &entries}
+		opts    = options.Find().SetSort(sortFields("-ts")).SetMaxTime(db.maxTime(profileColl))
+	)
+
+	// system.profile has no indexes, so unlike Find this skips the
+	// collection scan check
+	var err = db.exec(o, func(ctx context.Context, c *mongo.Collection) error {
+		var cur, err = c.Find(ctx, filter(query), opts)
+		if err != nil {
+			return err
+		}
+
+		if err = cur.All(ctx, &entries); err != nil {
+			return err
+		}
+
+		o.N = len(entries)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,256 @@
+package mongo
+
+import (
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Query builds a filter, e.g.
+//
+//	Q().Eq("status", "active").Gt("age", 10).In("type", "ap", "switch")
+//
+// Conditions on the same field are combined. A Query can be passed wherever
+// a query is expected, M returns it as a document
+type Query struct {
+	// keys are the fields and logical operators in the order they were
+	// first used, so that D and the marshalled filter are deterministic
+	keys   []string
+	fields map[string]bson.D
+	logic  map[string][]*Query
+}
+
+// Q starts an empty Query, which matches all documents
+func Q() *Query {
+	return &Query{fields: map[string]bson.D{}, logic: map[string][]*Query{}}
+}
+
+func (q *Query) op(field, op string, value interface{}) *Query {
+	var ops, ok = q.fields[field]
+	if !ok {
+		q.keys = append(q.keys, field)
+	}
+
+	for i := range ops {
+		if ops[i].Key == op {
+			ops[i].Value = value
+			return q
+		}
+	}
+
+	q.fields[field] = append(ops, bson.E{Key: op, Value: value})
+
+	return q
+}
+
+// Eq matches documents whose field equals value
+func (q *Query) Eq(field string, value interface{}) *Query {
+	return q.op(field, "$eq", value)
+}
+
+// Ne matches documents whose field doesn't equal value or is missing
+func (q *Query) Ne(field string, value interface{}) *Query {
+	return q.op(field, "$ne", value)
+}
+
+// Gt matches documents whose field is greater than value
+func (q *Query) Gt(field string, value interface{}) *Query {
+	return q.op(field, "$gt", value)
+}
+
+// Gte matches documents whose field is greater than or equal to value
+func (q *Query) Gte(field string, value interface{}) *Query {
+	return q.op(field, "$gte", value)
+}
+
+// Lt matches documents whose field is less than value
+func (q *Query) Lt(field string, value interface{}) *Query {
+	return q.op(field, "$lt", value)
+}
+
+// Lte matches documents whose field is less than or equal to value
+func (q *Query) Lte(field string, value interface{}) *Query {
+	return q.op(field, "$lte", value)
+}
+
+// In matches documents whose field equals one of values, a single slice is
+// taken as the list of values
+func (q *Query) In(field string, values ...interface{}) *Query {
+	return q.op(field, "$in", list(values))
+}
+
+// Nin matches documents whose field equals none of values, a single slice
+// is taken as the list of values
+func (q *Query) Nin(field string, values ...interface{}) *Query {
+	return q.op(field, "$nin", list(values))
+}
+
+// All matches documents whose array field contains all of values, a single
+// slice is taken as the list of values
+func (q *Query) All(field string, values ...interface{}) *Query {
+	return q.op(field, "$all", list(values))
+}
+
+// Exists matches documents that have field, or don't if exists is false
+func (q *Query) Exists(field string, exists bool) *Query {
+	return q.op(field, "$exists", exists)
+}
+
+// Regex matches documents whose field matches pattern, options are the
+// regular expression flags, e.g. "i" to ignore case
+func (q *Query) Regex(field, pattern, options string) *Query {
+	q.op(field, "$regex", pattern)
+
+	if options != "" {
+		q.op(field, "$options", options)
+	}
+
+	return q
+}
+
+// Size matches documents whose array field has n elements
+func (q *Query) Size(field string, n int) *Query {
+	return q.op(field, "$size", n)
+}
+
+// ElemMatch matches documents whose array field has an element matching
+// all conditions of match
+func (q *Query) ElemMatch(field string, match *Query) *Query {
+	return q.op(field, "$elemMatch", match.D())
+}
+
+// Or matches documents matching at least one of queries
+func (q *Query) Or(queries ...*Query) *Query {
+	return q.combine("$or", queries)
+}
+
+// And matches documents matching all queries, needed only to combine
+// several Or
+func (q *Query) And(queries ...*Query) *Query {
+	return q.combine("$and", queries)
+}
+
+// Nor matches documents matching none of queries
+func (q *Query) Nor(queries ...*Query) *Query {
+	return q.combine("$nor", queries)
+}
+
+func (q *Query) combine(op string, queries []*Query) *Query {
+	if _, ok := q.logic[op]; !ok {
+		q.keys = append(q.keys, op)
+	}
+
+	// later changes to queries don't change q
+	for _, query := range queries {
+		q.logic[op] = append(q.logic[op], query.clone())
+	}
+
+	return q
+}
+
+func (q *Query) clone() *Query {
+	var c = Q()
+
+	c.keys = append(c.keys, q.keys...)
+
+	for field, ops := range q.fields {
+		c.fields[field] = append(bson.D{}, ops...)
+	}
+
+	for op, clauses := range q.logic {
+		c.logic[op] = append([]*Query{}, clauses...)
+	}
+
+	return c
+}
+
+// M returns the filter document, a field with only an equality condition
+// is compared directly, e.g. M{"status": "active"}
+func (q *Query) M() bson.M {
+	var m = bson.M{}
+
+	for _, key := range q.keys {
+		if clauses, ok := q.logic[key]; ok {
+			var docs = make([]bson.M, len(clauses))
+			for i, clause := range clauses {
+				docs[i] = clause.M()
+			}
+
+			m[key] = docs
+			continue
+		}
+
+		var ops = q.fields[key]
+		if len(ops) == 1 && ops[0].Key == "$eq" {
+			m[key] = ops[0].Value
+			continue
+		}
+
+		var doc = bson.M{}
+		for _, e := range ops {
+			doc[e.Key] = e.Value
+		}
+
+		m[key] = doc
+	}
+
+	return m
+}
+
+// D returns the filter document like M, with the fields and conditions in
+// the order they were added
+func (q *Query) D() bson.D {
+	var d = bson.D{}
+
+	for _, key := range q.keys {
+		if clauses, ok := q.logic[key]; ok {
+			var docs = make([]bson.D, len(clauses))
+			for i, clause := range clauses {
+				docs[i] = clause.D()
+			}
+
+			d = append(d, bson.E{Key: key, Value: docs})
+			continue
+		}
+
+		var ops = q.fields[key]
+		if len(ops) == 1 && ops[0].Key == "$eq" {
+			d = append(d, bson.E{Key: key, Value: ops[0].Value})
+			continue
+		}
+
+		d = append(d, bson.E{Key: key, Value: append(bson.D{}, ops...)})
+	}
+
+	return d
+}
+
+// MarshalBSON marshals the filter document in order, so that a Query can
+// be used as a query
+func (q *Query) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(q.D())
+}
+
+// list returns the values of a variadic argument, or the elements of a
+// single slice
+func list(values []interface{}) []interface{} {
+	if len(values) == 0 {
+		return []interface{}{}
+	}
+
+	if len(values) > 1 {
+		return values
+	}
+
+	var v = reflect.ValueOf(values[0])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+
+	var elems = make([]interface{}, v.Len())
+	for i := range elems {
+		elems[i] = v.Index(i).Interface()
+	}
+
+	return elems
+}
@@ -0,0 +1,152 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxQueryShapes bounds the shapes tracked by WithQueryStats, further
+// shapes are counted as otherShape of their collection and operation
+const (
+	maxQueryShapes = 1000
+	otherShape     = "*"
+)
+
+// QueryStats is the load caused by a query shape on a collection since
+// WithQueryStats enabled tracking
+type QueryStats struct {
+	Collection string
+	Operation  string
+
+	// Shape is the query or pipeline with its values replaced by "?", "*"
+	// for the shapes beyond the first 1000
+	Shape       string
+	Fingerprint string
+
+	Count  int64
+	Errors int64
+	Total  time.Duration
+	Mean   time.Duration
+	Max    time.Duration
+}
+
+// queryStats holds the counters per query shape, shared by all handles of
+// a connection
+type queryStats struct {
+	m      sync.Map
+	shapes int64
+}
+
+type queryKey struct {
+	coll, op, shape string
+}
+
+type queryCounters struct {
+	count, errors, total, max int64
+}
+
+// WithQueryStats tracks the count and latency of every query shape per
+// collection, see QueryStats. Queries differing only in values share a
+// shape
+func WithQueryStats() Option {
+	return func(db *DB) {
+		db.queries = &queryStats{}
+	}
+}
+
+// Fingerprint identifies the shape of a query or pipeline: it is the same
+// for queries differing only in values, e.g. to correlate log entries
+func Fingerprint(query interface{}) string {
+	return fingerprint(shape(query))
+}
+
+func fingerprint(shape string) string {
+	var h = fnv.New64a()
+
+	_, _ = h.Write([]byte(shape))
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (q *queryStats) observe(o *Op, d time.Duration, err error) {
+	if q == nil {
+		return
+	}
+
+	var key = queryKey{o.Collection, o.Name, shape(o.Query)}
+
+	c, ok := q.m.Load(key)
+	if !ok {
+		if atomic.AddInt64(&q.shapes, 1) > maxQueryShapes {
+			key.shape = otherShape
+		}
+
+		c, _ = q.m.LoadOrStore(key, &queryCounters{})
+	}
+
+	var counters = c.(*queryCounters)
+
+	atomic.AddInt64(&counters.count, 1)
+	atomic.AddInt64(&counters.total, int64(d))
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		atomic.AddInt64(&counters.errors, 1)
+	}
+
+	for max := atomic.LoadInt64(&counters.max); int64(d) > max; max = atomic.LoadInt64(&counters.max) {
+		if atomic.CompareAndSwapInt64(&counters.max, max, int64(d)) {
+			break
+		}
+	}
+}
+
+// QueryStats returns the load per query shape and collection, the heaviest
+// by total time first, e.g. to find the top query patterns. Empty unless
+// WithQueryStats is set, retries are counted as separate queries
+func (db *DB) QueryStats() []QueryStats {
+	var report = []QueryStats{}
+
+	if db.queries == nil {
+		return report
+	}
+
+	db.queries.m.Range(func(k, c interface{}) bool {
+		var (
+			key      = k.(queryKey)
+			counters = c.(*queryCounters)
+			s        = QueryStats{
+				Collection:  key.coll,
+				Operation:   key.op,
+				Shape:       key.shape,
+				Fingerprint: fingerprint(key.shape),
+				Count:       atomic.LoadInt64(&counters.count),
+				Errors:      atomic.LoadInt64(&counters.errors),
+				Total:       time.Duration(atomic.LoadInt64(&counters.total)),
+				Max:         time.Duration(atomic.LoadInt64(&counters.max)),
+			}
+		)
+
+		if s.Count > 0 {
+			s.Mean = s.Total / time.Duration(s.Count)
+		}
+
+		report = append(report, s)
+
+		return true
+	})
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Total != report[j].Total {
+			return report[i].Total > report[j].Total
+		}
+
+		return report[i].Fingerprint < report[j].Fingerprint
+	})
+
+	return report
+}
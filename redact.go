@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const redacted = "xxxxx"
+
+// RedactDSN replaces the password of a connection string, it is safe to log
+// the result
+func RedactDSN(dsn string) string {
+	var start, end = passwordSpan(dsn)
+	if start == end {
+		return dsn
+	}
+
+	return dsn[:start] + redacted + dsn[end:]
+}
+
+// passwordSpan returns the bounds of the password in dsn, start equals end
+// if there is none
+func passwordSpan(dsn string) (start, end int) {
+	var i = strings.Index(dsn, "://")
+	if i < 0 {
+		return 0, 0
+	}
+
+	var hosts = dsn[i+3:]
+
+	if slash := strings.IndexAny(hosts, "/?"); slash >= 0 {
+		hosts = hosts[:slash]
+	}
+
+	var at = strings.LastIndex(hosts, "@")
+	if at < 0 {
+		return 0, 0
+	}
+
+	var colon = strings.Index(hosts[:at], ":")
+	if colon < 0 {
+		return 0, 0
+	}
+
+	return i + 3 + colon + 1, i + 3 + at
+}
+
+// redactError hides the credentials of dsn in the message of err while
+// keeping it usable with errors.Is and errors.As
+func redactError(err error, dsn string) error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		msg        = err.Error()
+		start, end = passwordSpan(dsn)
+	)
+
+	if start == end {
+		return err
+	}
+
+	var secrets = []string{dsn[start:end]}
+
+	if password, perr := url.PathUnescape(dsn[start:end]); perr == nil {
+		secrets = append(secrets, password)
+	}
+
+	if !containsAny(msg, secrets) {
+		return err
+	}
+
+	msg = strings.ReplaceAll(msg, dsn, RedactDSN(dsn))
+
+	for _, secret := range secrets {
+		msg = strings.ReplaceAll(msg, secret, redacted)
+	}
+
+	return &redactedError{msg: msg, err: err}
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if sub != "" && strings.Contains(s, sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// String of the config with the password redacted
+func (c Config) String() string {
+	if c.Password != "" {
+		c.Password = redacted
+	}
+
+	type config Config
+
+	return fmt.Sprintf("%+v", config(c))
+}
+
+// GoString of the config with the password redacted
+func (c Config) GoString() string {
+	return "mongo.Config" + c.String()
+}
@@ -0,0 +1,241 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+const (
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// transientCodes are server errors of a deployment changing its primary or
+// shutting down, the operation may succeed on the next primary
+var transientCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// idempotentOps are update operators whose repetition doesn't change the
+// result of the first application
+var idempotentOps = map[string]bool{
+	"$set":         true,
+	"$unset":       true,
+	"$setOnInsert": true,
+	"$min":         true,
+	"$max":         true,
+	"$addToSet":    true,
+	"$pull":        true,
+	"$pullAll":     true,
+}
+
+// RetryPolicy controls how operations failing with a retryable error are
+// repeated. The zero value doesn't retry
+type RetryPolicy struct {
+	// MaxAttempts in total, the first one included
+	MaxAttempts int
+
+	// Backoff before the first retry, it doubles with every further one up
+	// to MaxBackoff, 100ms and 5s if zero
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter varies every backoff randomly by up to this fraction of it,
+	// e.g. 0.2 for +-20%, so that clients don't retry in lockstep
+	Jitter float64
+
+	// Retryable classifies errors, IsTransient if nil
+	Retryable func(err error) bool
+}
+
+// WithReadRetry retries reads according to p, e.g. to ride out elections:
+// RetryPolicy{MaxAttempts: 4, Jitter: 0.2}. Reads in transactions are not
+// retried, WithTransaction retries the transaction as a whole
+func WithReadRetry(p RetryPolicy) Option {
+	return func(db *DB) {
+		db.readRetry = &p
+	}
+}
+
+// WithWriteRetries retries writes failing with a transient error up to n
+// times with exponential backoff, see IsTransient. The driver retries a
+// write once by itself, this covers longer elections. Only writes that can
+// be repeated safely are retried: replacements, upserts, removals and
+// updates using only $set, $unset, $setOnInsert, $min, $max, $addToSet,
+// $pull and $pullAll. Inserts and writes in transactions are not retried
+func WithWriteRetries(n int) Option {
+	return func(db *DB) {
+		db.writeRetry = &RetryPolicy{MaxAttempts: n + 1}
+	}
+}
+
+// IsTransient reports whether err is caused by a network failure or a
+// change of the primary, so that the operation may succeed when repeated.
+// That includes failing to select a server, e.g. during an election
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+
+	var sse topology.ServerSelectionError
+	if errors.As(err, &sse) {
+		return true
+	}
+
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	if se.HasErrorLabel("RetryableWriteError") {
+		return true
+	}
+
+	for _, code := range transientCodes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// read runs exec with the read retry policy of db
+func (db *DB) read(o *Op, fn func(context.Context, *mongo.Collection) error) error {
+	if err := db.checkCollScan(o); err != nil {
+		return err
+	}
+
+	return db.retry(db.readRetry, o, fn)
+}
+
+// write runs exec and, if the write is idempotent, with the write retry
+// policy of db
+func (db *DB) write(o *Op, idempotent bool,
+	fn func(context.Context, *mongo.Collection) error) error {
+	if !idempotent {
+		return db.exec(o, fn)
+	}
+
+	return db.retry(db.writeRetry, o, fn)
+}
+
+// retry runs exec and repeats it according to p, unless db is bound to a
+// transaction
+func (db *DB) retry(p *RetryPolicy, o *Op,
+	fn func(context.Context, *mongo.Collection) error) error {
+	var err = db.exec(o, fn)
+
+	if p == nil || db.inTransaction() {
+		return err
+	}
+
+	var retryable = p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	for attempt := 1; attempt < p.MaxAttempts && err != nil && retryable(err); attempt++ {
+		var wait = p.backoff(attempt)
+
+		db.logger().Warnf("mongo: %s %s: retry %d in %v: %v", o.Name, o.Collection, attempt, wait, err)
+
+		if serr := sleep(db.parent(), wait); serr != nil {
+			return fmt.Errorf("%w, retry abandoned: %v", serr, err)
+		}
+
+		err = db.exec(o, fn)
+	}
+
+	return err
+}
+
+// sleep waits for d or until ctx is done, whichever comes first
+func sleep(ctx context.Context, d time.Duration) error {
+	var timer = time.NewTimer(d)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff before the given retry, counting from 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	var d, max = p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = minRetryBackoff
+	}
+
+	if max <= 0 {
+		max = maxRetryBackoff
+	}
+
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// idempotent reports whether applying update twice has the same result as
+// applying it once, replacement documents always do
+func idempotent(update interface{}) bool {
+	var raw, err = bson.Marshal(update)
+	if err != nil {
+		return false
+	}
+
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return false
+	}
+
+	for i, elem := range elems {
+		var key = elem.Key()
+
+		if i == 0 && !strings.HasPrefix(key, "$") {
+			return true
+		}
+
+		if !idempotentOps[key] {
+			return false
+		}
+	}
+
+	return true
+}
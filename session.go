@@ -0,0 +1,63 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Session is a DB bound to a causally consistent session: every read issued
+// through it observes the writes issued through it before, also when reading
+// from secondaries, e.g. s.Insert(...) followed by s.Eventual().Find(...).
+// Reads and writes use majority concern to make that guarantee hold across
+// failovers. A Session must not be used by concurrent goroutines
+type Session struct {
+	*DB
+
+	sess  mongo.Session
+	conn  *conn
+	close sync.Once
+}
+
+// StartCausalSession starts a causally consistent session, it must be closed
+// when done
+func (db *DB) StartCausalSession() (*Session, error) {
+	var c = db.link.acquire()
+	if c == nil {
+		return nil, ErrNotConnected
+	}
+
+	var sess, err = c.client.StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		c.users.Done()
+		return nil, err
+	}
+
+	var parent = db.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	var handle = db.derive()
+
+	// the session belongs to the client, so the handle keeps using it
+	// when the connection of db is replaced
+	handle.link = &link{conn: c}
+	handle.ctx = mongo.NewSessionContext(parent, sess)
+	handle.readConcern = readconcern.Majority()
+	handle.writeConcern = writeconcern.Majority()
+
+	return &Session{DB: handle, sess: sess, conn: c}, nil
+}
+
+// Close ends the session
+func (s *Session) Close() {
+	s.close.Do(func() {
+		s.sess.EndSession(context.Background())
+		s.conn.users.Done()
+	})
+}
@@ -0,0 +1,73 @@
+package mongo
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// shape renders a query or pipeline as JSON with every value replaced by
+// "?" and the keys of documents sorted, e.g. {"age": {"$gt": "?"}}. It is
+// safe to log and the same for queries differing only in values
+func shape(query interface{}) string {
+	if query == nil {
+		return "{}"
+	}
+
+	var t, data, err = bson.MarshalValue(query)
+	if err != nil {
+		return `"?"`
+	}
+
+	var b strings.Builder
+
+	writeShape(&b, bson.RawValue{Type: t, Value: data})
+
+	return b.String()
+}
+
+func writeShape(b *strings.Builder, v bson.RawValue) {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		var elems, _ = v.Document().Elements()
+
+		sort.Slice(elems, func(i, j int) bool { return elems[i].Key() < elems[j].Key() })
+
+		b.WriteByte('{')
+		for i, elem := range elems {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+
+			b.WriteString(strconv.Quote(elem.Key()))
+			b.WriteString(": ")
+			writeShape(b, elem.Value())
+		}
+		b.WriteByte('}')
+
+	case bsontype.Array:
+		var values, _ = v.Array().Values()
+
+		// arrays of documents are structure, e.g. pipelines or $or
+		if len(values) == 0 || values[0].Type != bsontype.EmbeddedDocument {
+			b.WriteString(`"?"`)
+			return
+		}
+
+		b.WriteByte('[')
+		for i, value := range values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+
+			writeShape(b, value)
+		}
+		b.WriteByte(']')
+
+	default:
+		b.WriteString(`"?"`)
+	}
+}
@@ -0,0 +1,102 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShutdown is returned by operations started after Shutdown
+var ErrShutdown = errors.New("DB is shutting down")
+
+// inflight counts running operations so that Shutdown can wait for them
+type inflight struct {
+	sync.Mutex
+
+	closed bool
+	active int
+	idle   chan struct{}
+	stop   chan struct{}
+}
+
+func (f *inflight) enter() bool {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return false
+	}
+
+	f.active++
+
+	return true
+}
+
+func (f *inflight) leave() {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.active--; f.active == 0 && f.closed {
+		close(f.idle)
+	}
+}
+
+// stopping returns a channel that is closed by close, to end operations
+// that run until they are stopped, e.g. change streams
+func (f *inflight) stopping() <-chan struct{} {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.stop == nil {
+		f.stop = make(chan struct{})
+	}
+
+	return f.stop
+}
+
+// close rejects new operations, the returned channel is closed once the
+// running ones finished
+func (f *inflight) close() <-chan struct{} {
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.closed {
+		f.closed = true
+		f.idle = make(chan struct{})
+
+		if f.stop == nil {
+			f.stop = make(chan struct{})
+		}
+
+		close(f.stop)
+
+		if f.active == 0 {
+			close(f.idle)
+		}
+	}
+
+	return f.idle
+}
+
+// Shutdown stops accepting operations, waits for running ones to finish and
+// disconnects. Open Iters and ForEach and FindChan calls count as running
+// until they are closed or done. Change streams don't end by themselves,
+// they are stopped and waited for until closed. If ctx expires first the
+// connection is closed regardless and the context error returned
+func (db *DB) Shutdown(ctx context.Context) error {
+	if !db.IsConnected() {
+		return ErrNotConnected
+	}
+
+	var err error
+
+	select {
+	case <-db.ops.close():
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	db.Disconnect()
+
+	return err
+}
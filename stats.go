@@ -0,0 +1,65 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CollStats are the storage statistics of a collection, sizes in bytes
+type CollStats struct {
+	Namespace      string           `bson:"ns"`
+	Count          int64            `bson:"count"`
+	Size           int64            `bson:"size"`
+	AvgObjSize     float64          `bson:"avgObjSize"`
+	StorageSize    int64            `bson:"storageSize"`
+	Indexes        int              `bson:"nindexes"`
+	TotalIndexSize int64            `bson:"totalIndexSize"`
+	IndexSizes     map[string]int64 `bson:"indexSizes"`
+	Capped         bool             `bson:"capped"`
+}
+
+// DBStats are the storage statistics of the database, sizes in bytes
+type DBStats struct {
+	Database    string  `bson:"db"`
+	Collections int     `bson:"collections"`
+	Views       int     `bson:"views"`
+	Objects     int64   `bson:"objects"`
+	AvgObjSize  float64 `bson:"avgObjSize"`
+	DataSize    int64   `bson:"dataSize"`
+	StorageSize int64   `bson:"storageSize"`
+	Indexes     int     `bson:"indexes"`
+	IndexSize   int64   `bson:"indexSize"`
+	TotalSize   int64   `bson:"totalSize"`
+	FsUsedSize  int64   `bson:"fsUsedSize"`
+	FsTotalSize int64   `bson:"fsTotalSize"`
+}
+
+// CollStats returns the storage statistics of coll
+func (db *DB) CollStats(coll string) (*CollStats, error) {
+	var stats CollStats
+
+	var err = db.read(&Op{Name: "collStats", Collection: coll}, func(ctx context.Context, c *mongo.Collection) error {
+		return c.Database().RunCommand(ctx, bson.D{{Key: "collStats", Value: coll}}).Decode(&stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// DBStats returns the storage statistics of the database
+func (db *DB) DBStats() (*DBStats, error) {
+	var stats DBStats
+
+	var err = db.read(&Op{Name: "dbStats"}, func(ctx context.Context, c *mongo.Collection) error {
+		return c.Database().RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,258 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Codes of errors of replSetGetStatus on servers that can't tell about
+// replication: a standalone, mongos and a user without clusterMonitor
+const (
+	codeNoReplication = 76
+	codeNotFound      = 59
+	codeUnauthorized  = 13
+)
+
+// ServerMetrics are the key figures of serverStatus of the server db reads
+// from and the replication lag of its replica set
+type ServerMetrics struct {
+	Host    string
+	Version string
+	Uptime  time.Duration
+
+	Connections ConnectionMetrics
+	Opcounters  OpCounters
+
+	// ReplicationLag of the secondary most behind the primary, zero if
+	// there is no replica set
+	ReplicationLag time.Duration
+}
+
+// ConnectionMetrics are the incoming connections of a server
+type ConnectionMetrics struct {
+	Current      int64 `bson:"current"`
+	Available    int64 `bson:"available"`
+	TotalCreated int64 `bson:"totalCreated"`
+}
+
+// OpCounters count the operations since the server started
+type OpCounters struct {
+	Insert  int64 `bson:"insert"`
+	Query   int64 `bson:"query"`
+	Update  int64 `bson:"update"`
+	Delete  int64 `bson:"delete"`
+	GetMore int64 `bson:"getmore"`
+	Command int64 `bson:"command"`
+}
+
+type serverStatus struct {
+	Host        string            `bson:"host"`
+	Version     string            `bson:"version"`
+	Uptime      float64           `bson:"uptime"`
+	Connections ConnectionMetrics `bson:"connections"`
+	Opcounters  OpCounters        `bson:"opcounters"`
+}
+
+type replSetStatus struct {
+	Members []replMember `bson:"members"`
+}
+
+type replMember struct {
+	Name       string    `bson:"name"`
+	State      string    `bson:"stateStr"`
+	Health     float64   `bson:"health"`
+	OptimeDate time.Time `bson:"optimeDate"`
+}
+
+// adminCommand runs cmd against the admin database and decodes the reply
+// into v. Like other commands that don't target a collection it is reported
+// without one
+func (db *DB) adminCommand(name string, cmd bson.D, v interface{}) error {
+	return db.exec(&Op{Name: name}, func(ctx context.Context, c *mongo.Collection) error {
+		return c.Database().Client().Database("admin").RunCommand(ctx, cmd).Decode(v)
+	})
+}
+
+// ServerStatus collects the ServerMetrics once
+func (db *DB) ServerStatus() (*ServerMetrics, error) {
+	var status serverStatus
+
+	if err := db.adminCommand("serverStatus", bson.D{{Key: "serverStatus", Value: 1}}, &status); err != nil {
+		return nil, err
+	}
+
+	var m = &ServerMetrics{
+		Host:        status.Host,
+		Version:     status.Version,
+		Uptime:      time.Duration(status.Uptime * float64(time.Second)),
+		Connections: status.Connections,
+		Opcounters:  status.Opcounters,
+	}
+
+	var rs, err = db.replSetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	m.ReplicationLag = rs.maxLag()
+
+	return m, nil
+}
+
+// replSetStatus returns the status of the replica set, empty on a
+// standalone server, mongos or without the privilege to read it
+func (db *DB) replSetStatus() (*replSetStatus, error) {
+	var rs replSetStatus
+
+	var err = db.adminCommand("replSetGetStatus", bson.D{{Key: "replSetGetStatus", Value: 1}}, &rs)
+	if noReplicationInfo(err) {
+		return &replSetStatus{}, nil
+	}
+
+	return &rs, err
+}
+
+func noReplicationInfo(err error) bool {
+	var se mongo.ServerError
+
+	return errors.As(err, &se) &&
+		(se.HasErrorCode(codeNoReplication) || se.HasErrorCode(codeNotFound) || se.HasErrorCode(codeUnauthorized))
+}
+
+// lags returns how far each healthy secondary is behind the primary
+func (rs *replSetStatus) lags() map[string]time.Duration {
+	var (
+		lags    = map[string]time.Duration{}
+		primary time.Time
+	)
+
+	for _, m := range rs.Members {
+		if m.State == "PRIMARY" {
+			primary = m.OptimeDate
+		}
+	}
+
+	if primary.IsZero() {
+		return lags
+	}
+
+	for _, m := range rs.Members {
+		if m.State == "SECONDARY" && m.Health > 0 {
+			if lags[m.Name] = primary.Sub(m.OptimeDate); lags[m.Name] < 0 {
+				lags[m.Name] = 0
+			}
+		}
+	}
+
+	return lags
+}
+
+func (rs *replSetStatus) maxLag() time.Duration {
+	var max time.Duration
+
+	for _, lag := range rs.lags() {
+		if lag > max {
+			max = lag
+		}
+	}
+
+	return max
+}
+
+// ReplicationLag returns how far each healthy secondary is behind the
+// primary by host, empty if there is no replica set
+func (db *DB) ReplicationLag() (map[string]time.Duration, error) {
+	var rs, err = db.replSetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.lags(), nil
+}
+
+// PollServerStatus calls fn with the ServerMetrics every interval until the
+// returned stop is called or db is disconnected, e.g. to feed dashboards
+// without a separate exporter. Failed polls are logged and skipped. An
+// interval that isn't positive polls every 10s
+func (db *DB) PollServerStatus(interval time.Duration, fn func(*ServerMetrics)) (stop func()) {
+	return db.poll("server status", interval, func() error {
+		var m, err = db.ServerStatus()
+		if err == nil {
+			fn(m)
+		}
+
+		return err
+	})
+}
+
+// WatchReplicationLag checks the replication lag every interval and calls fn
+// with true once the lag of a secondary exceeds threshold, and with false
+// once all of them caught up again, e.g. to pause and resume batch jobs.
+// It runs until the returned stop is called or db is disconnected, an
+// interval that isn't positive checks every 10s
+func (db *DB) WatchReplicationLag(threshold, interval time.Duration,
+	fn func(lagging bool, lag time.Duration)) (stop func()) {
+	var lagging bool
+
+	return db.poll("replication lag", interval, func() error {
+		var rs, err = db.replSetStatus()
+		if err != nil {
+			return err
+		}
+
+		if lag := rs.maxLag(); lag > threshold != lagging {
+			lagging = !lagging
+			fn(lagging, lag)
+		}
+
+		return nil
+	})
+}
+
+// defaultPollInterval replaces intervals of polls that aren't positive
+const defaultPollInterval = 10 * time.Second
+
+// poll calls fn every interval until stop is called or db is disconnected,
+// errors other than ErrNotConnected are logged
+func (db *DB) poll(what string, interval time.Duration, fn func() error) (stop func()) {
+	if interval <= 0 {
+		db.logger().Warnf("mongo: %s: interval %v is not positive, polling every %v",
+			what, interval, defaultPollInterval)
+
+		interval = defaultPollInterval
+	}
+
+	var done = make(chan struct{})
+
+	go func() {
+		var ticker = time.NewTicker(interval)
+
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			var err = fn()
+
+			switch {
+			case errors.Is(err, ErrNotConnected):
+				return
+			case err != nil:
+				db.logger().Warnf("mongo: %s: %v", what, err)
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,100 @@
+package mongo
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultScoreField = "score"
+
+// CreateTextIndex creates the text index of coll over fields, a collection
+// can only have one text index
+func (db *DB) CreateTextIndex(coll string, fields ...string) error {
+	var keys = make([]string, len(fields))
+
+	for i, field := range fields {
+		keys[i] = "$text:" + field
+	}
+
+	return db.CreateIndex(coll, Index{Keys: keys})
+}
+
+// TextSearchOptions for TextSearch, zero values are left unset
+type TextSearchOptions struct {
+	// Filter is combined with the $text query, e.g. a map, a bson.D or a
+	// *Query. It can't have a $text of its own
+	Filter interface{}
+
+	Language           string
+	CaseSensitive      bool
+	DiacriticSensitive bool
+
+	Limit int
+	Skip  int
+
+	// ScoreField receives the relevance of each document, "score" if empty
+	ScoreField string
+}
+
+// TextSearch decodes the documents matching phrase into v, ordered by
+// relevance. coll must have a text index, see CreateTextIndex
+func (db *DB) TextSearch(coll string, phrase string, opts *TextSearchOptions, v interface{}) error {
+	if opts == nil {
+		opts = &TextSearchOptions{}
+	}
+
+	var query, err = textQuery(phrase, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", coll, err)
+	}
+
+	var scoreField = opts.ScoreField
+	if scoreField == "" {
+		scoreField = defaultScoreField
+	}
+
+	var score = bson.M{"$meta": "textScore"}
+
+	var findOpts = options.Find().
+		SetProjection(bson.M{scoreField: score}).
+		SetSort(bson.D{{Key: scoreField, Value: score}})
+
+	if opts.Limit > 0 {
+		findOpts.SetLimit(int64(opts.Limit))
+	}
+
+	if opts.Skip > 0 {
+		findOpts.SetSkip(int64(opts.Skip))
+	}
+
+	return db.findAll(coll, query, findOpts, v)
+}
+
+// textQuery returns the filter of TextSearch
+func textQuery(phrase string, opts *TextSearchOptions) (bson.M, error) {
+	var text = bson.M{"$search": phrase}
+
+	if opts.Language != "" {
+		text["$language"] = opts.Language
+	}
+
+	if opts.CaseSensitive {
+		text["$caseSensitive"] = true
+	}
+
+	if opts.DiacriticSensitive {
+		text["$diacriticSensitive"] = true
+	}
+
+	if opts.Filter == nil {
+		return bson.M{"$text": text}, nil
+	}
+
+	if _, ok := lookup(opts.Filter, "$text"); ok {
+		return nil, fmt.Errorf("%w: filter has a $text of its own", ErrInvalidQuery)
+	}
+
+	return bson.M{"$and": bson.A{bson.M{"$text": text}, filter(opts.Filter)}}, nil
+}
@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WithTLS connects over TLS with cfg, e.g. one returned by LoadTLSConfig
+func WithTLS(cfg *tls.Config) Option {
+	return WithClientOptions(options.Client().SetTLSConfig(cfg))
+}
+
+// LoadTLSConfig builds a TLS config trusting the PEM encoded CA in caFile,
+// the system pool is used if it is empty. certFile and keyFile hold the
+// client certificate and may be empty when the server doesn't require one
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	var cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		var pem, err = os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		var cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,52 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/wimark/mongo"
+
+// WithTracerProvider traces every operation as a client span of tp with the
+// collection, operation and query shape. Spans are children of the context
+// of the handle, see WithContext
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(db *DB) {
+		db.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func (db *DB) startSpan(ctx context.Context, o *Op) (context.Context, trace.Span) {
+	if db.tracer == nil {
+		return ctx, nil
+	}
+
+	return db.tracer.Start(ctx, o.Name+" "+o.Collection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", db.DatabaseName()),
+			attribute.String("db.mongodb.collection", o.Collection),
+			attribute.String("db.operation", o.Name),
+			attribute.String("db.statement", shape(o.Query)),
+		))
+}
+
+func endSpan(span trace.Span, o *Op, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("db.mongodb.documents", o.N))
+	}
+
+	span.End()
+}
@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Tx is a DB bound to a transaction, every operation issued through it is
+// part of the transaction
+type Tx struct {
+	*DB
+}
+
+// txKey marks the contexts of Tx handles
+type txKey struct{}
+
+// WithTransaction runs fn in a multi-document transaction and commits it
+// when fn returns nil, otherwise the transaction is aborted and the error
+// of fn is returned. On transient transaction errors the whole transaction,
+// fn included, is retried until the context of db is done, see WithContext,
+// so fn must not have side effects outside of tx
+func (db *DB) WithTransaction(fn func(tx *Tx) error) error {
+	var c = db.link.acquire()
+	if c == nil {
+		return ErrNotConnected
+	}
+
+	defer c.users.Done()
+
+	var sess, err = c.client.StartSession()
+	if err != nil {
+		return err
+	}
+
+	defer sess.EndSession(context.Background())
+
+	// a cancelled or expired context of db ends the retries
+	_, err = sess.WithTransaction(db.parent(),
+		func(sc mongo.SessionContext) (interface{}, error) {
+			var tx = db.derive()
+
+			tx.link = &link{conn: c}
+			tx.ctx = context.WithValue(sc, txKey{}, true)
+
+			return nil, fn(&Tx{DB: tx})
+		})
+
+	return err
+}
+
+// inTransaction reports whether operations of db run in a transaction
+func (db *DB) inTransaction() bool {
+	return db.ctx != nil && db.ctx.Value(txKey{}) != nil
+}
@@ -0,0 +1,263 @@
+package mongo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BuildUpdate returns the update that turns the document old into updated,
+// e.g. two values of a struct before and after a PATCH request: $set for
+// changed fields and $unset for removed ones, as marshalled with their bson
+// tags. Embedded documents are compared field by field, arrays as a whole.
+// Without differences the update is empty and shouldn't be applied
+func BuildUpdate(old, updated interface{}) (bson.M, error) {
+	var from, err = bson.Marshal(old)
+	if err != nil {
+		return nil, fmt.Errorf("%w: old: %v", ErrInvalidQuery, err)
+	}
+
+	to, err := bson.Marshal(updated)
+	if err != nil {
+		return nil, fmt.Errorf("%w: updated: %v", ErrInvalidQuery, err)
+	}
+
+	if !plainKeys(from) || !plainKeys(to) {
+		return nil, fmt.Errorf("%w: field names with $ or dots can't be updated", ErrInvalidQuery)
+	}
+
+	var set, unset = bson.M{}, bson.M{}
+
+	if err = diff("", from, to, set, unset); err != nil {
+		return nil, err
+	}
+
+	var update = bson.M{}
+
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update, nil
+}
+
+// diff adds the fields of the documents from and to that differ to set and
+// unset, with their paths below prefix
+func diff(prefix string, from, to bson.Raw, set, unset bson.M) error {
+	var old, err = from.Elements()
+	if err != nil {
+		return err
+	}
+
+	elems, err := to.Elements()
+	if err != nil {
+		return err
+	}
+
+	var values = map[string]bson.RawValue{}
+	for _, e := range old {
+		values[e.Key()] = e.Value()
+	}
+
+	for _, e := range elems {
+		var (
+			key      = e.Key()
+			v        = e.Value()
+			prev, ok = values[key]
+		)
+
+		delete(values, key)
+
+		if ok && prev.Type == v.Type && bytes.Equal(prev.Value, v.Value) {
+			continue
+		}
+
+		if ok && prev.Type == bson.TypeEmbeddedDocument && v.Type == bson.TypeEmbeddedDocument &&
+			plainKeys(prev.Document()) && plainKeys(v.Document()) {
+			if err = diff(prefix+key+".", prev.Document(), v.Document(), set, unset); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		set[prefix+key] = v
+	}
+
+	for key := range values {
+		unset[prefix+key] = ""
+	}
+
+	return nil
+}
+
+// plainKeys reports whether the keys of doc can be part of a path
+func plainKeys(doc bson.Raw) bool {
+	var elems, err = doc.Elements()
+	if err != nil {
+		return false
+	}
+
+	for _, e := range elems {
+		if e.Key() == "" || strings.HasPrefix(e.Key(), "$") || strings.Contains(e.Key(), ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UpdateBuilder builds an update document of dotted paths, e.g.
+//
+//	NewUpdate().Set("network.ssid", "office").Unset("legacy").Inc("stats.count", 1)
+//
+// Setting the same path again replaces the value. Empty paths, paths
+// starting with $, non-numeric increments and operators on the same or
+// overlapping paths, which the server rejects, are reported by Build. An
+// UpdateBuilder can be passed wherever an update is expected, DB.Update
+// applies it instead of setting its fields
+type UpdateBuilder struct {
+	ops   []string
+	docs  map[string]bson.D
+	paths map[string]string
+	errs  []error
+}
+
+// NewUpdate starts an empty update
+func NewUpdate() *UpdateBuilder {
+	return &UpdateBuilder{docs: map[string]bson.D{}, paths: map[string]string{}}
+}
+
+func (u *UpdateBuilder) op(op, path string, value interface{}) *UpdateBuilder {
+	if !validField(path) {
+		u.fail("%s of %q: not a field path", op, path)
+		return u
+	}
+
+	if prev, ok := u.paths[path]; ok && prev != op {
+		u.fail("%s of %s conflicts with %s", op, path, prev)
+		return u
+	}
+
+	for p, prev := range u.paths {
+		if strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+			u.fail("%s of %s conflicts with %s of %s", op, path, prev, p)
+			return u
+		}
+	}
+
+	var doc, ok = u.docs[op]
+	if !ok {
+		u.ops = append(u.ops, op)
+	}
+
+	for i := range doc {
+		if doc[i].Key == path {
+			doc[i].Value = value
+			return u
+		}
+	}
+
+	u.docs[op] = append(doc, bson.E{Key: path, Value: value})
+	u.paths[path] = op
+
+	return u
+}
+
+func (u *UpdateBuilder) fail(format string, args ...interface{}) {
+	u.errs = append(u.errs, fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...)))
+}
+
+// Set sets the field at path to value
+func (u *UpdateBuilder) Set(path string, value interface{}) *UpdateBuilder {
+	return u.op("$set", path, value)
+}
+
+// SetOnInsert sets the field at path to value only if an upsert inserts
+// the document
+func (u *UpdateBuilder) SetOnInsert(path string, value interface{}) *UpdateBuilder {
+	return u.op("$setOnInsert", path, value)
+}
+
+// Unset removes the field at path
+func (u *UpdateBuilder) Unset(path string) *UpdateBuilder {
+	return u.op("$unset", path, "")
+}
+
+// Inc adds delta, a number, to the field at path
+func (u *UpdateBuilder) Inc(path string, delta interface{}) *UpdateBuilder {
+	return u.number("$inc", path, delta)
+}
+
+// Min sets the field at path to value if value is less
+func (u *UpdateBuilder) Min(path string, value interface{}) *UpdateBuilder {
+	return u.op("$min", path, value)
+}
+
+// Max sets the field at path to value if value is greater
+func (u *UpdateBuilder) Max(path string, value interface{}) *UpdateBuilder {
+	return u.op("$max", path, value)
+}
+
+func (u *UpdateBuilder) number(op, path string, value interface{}) *UpdateBuilder {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return u.op(op, path, value)
+	}
+
+	u.fail("%s of %s: %T is not a number", op, path, value)
+
+	return u
+}
+
+// Build returns the update document with the operators in the order they
+// were first used, or the mistakes made building it wrapping
+// ErrInvalidQuery
+func (u *UpdateBuilder) Build() (bson.D, error) {
+	if len(u.errs) > 0 {
+		return nil, errors.Join(u.errs...)
+	}
+
+	if len(u.ops) == 0 {
+		return nil, fmt.Errorf("%w: empty update", ErrInvalidQuery)
+	}
+
+	var update = bson.D{}
+
+	for _, op := range u.ops {
+		update = append(update, bson.E{Key: op, Value: append(bson.D{}, u.docs[op]...)})
+	}
+
+	return update, nil
+}
+
+// MarshalBSON marshals the update document, so that an UpdateBuilder can be
+// used as an update. It fails with the mistakes reported by Build
+func (u *UpdateBuilder) MarshalBSON() ([]byte, error) {
+	var update, err = u.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.Marshal(update)
+}
+
+// setUpdate returns the update setting the fields of v, or the update built
+// by v if it is an UpdateBuilder
+func setUpdate(v interface{}) (interface{}, error) {
+	if u, ok := v.(*UpdateBuilder); ok {
+		return u.Build()
+	}
+
+	return bson.M{"$set": v}, nil
+}
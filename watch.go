@@ -0,0 +1,200 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeEvent is a single event of a change stream
+type ChangeEvent struct {
+	// ResumeToken of the event, pass it to WatchOptions.ResumeAfter to
+	// continue after this event
+	ResumeToken bson.Raw `bson:"_id"`
+
+	// OperationType is "insert", "update", "replace", "delete" etc.
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   bson.M              `bson:"documentKey"`
+
+	// FullDocument is set for inserts and replaces, and for updates when
+	// WatchOptions.FullDocument is enabled
+	FullDocument bson.Raw `bson:"fullDocument,omitempty"`
+
+	UpdateDescription *UpdateDescription `bson:"updateDescription,omitempty"`
+}
+
+// UpdateDescription of an update event
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// Decode unmarshals the full document of the event into v
+func (ev *ChangeEvent) Decode(v interface{}) error {
+	if len(ev.FullDocument) == 0 {
+		return ErrNotFound
+	}
+
+	return bson.Unmarshal(ev.FullDocument, v)
+}
+
+// WatchOptions for WatchWithOptions, zero values are left unset
+type WatchOptions struct {
+	// ResumeAfter or StartAfter a resume token of a previous stream
+	ResumeAfter bson.Raw
+	StartAfter  bson.Raw
+
+	// FullDocument looks up the current document for update events
+	FullDocument bool
+
+	BatchSize    int
+	MaxAwaitTime time.Duration
+}
+
+func (o *WatchOptions) changeStream() *options.ChangeStreamOptions {
+	var opts = options.ChangeStream()
+	if o == nil {
+		return opts
+	}
+
+	if len(o.ResumeAfter) > 0 {
+		opts.SetResumeAfter(o.ResumeAfter)
+	}
+
+	if len(o.StartAfter) > 0 {
+		opts.SetStartAfter(o.StartAfter)
+	}
+
+	if o.FullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+
+	if o.BatchSize > 0 {
+		opts.SetBatchSize(int32(o.BatchSize))
+	}
+
+	if o.MaxAwaitTime > 0 {
+		opts.SetMaxAwaitTime(o.MaxAwaitTime)
+	}
+
+	return opts
+}
+
+// ChangeStream delivers change events of a collection until closed
+type ChangeStream struct {
+	cs     *mongo.ChangeStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	parent context.Context
+	ops    *inflight
+	err    error
+	close  sync.Once
+}
+
+// Next blocks until the next event is available and decodes it into ev,
+// it returns false once the stream is closed or failed, see Err
+func (s *ChangeStream) Next(ev *ChangeEvent) bool {
+	if !s.cs.Next(s.ctx) {
+		return false
+	}
+
+	*ev = ChangeEvent{}
+
+	if s.err = s.cs.Decode(ev); s.err != nil {
+		return false
+	}
+
+	return true
+}
+
+// ResumeToken of the last returned event
+func (s *ChangeStream) ResumeToken() bson.Raw {
+	return s.cs.ResumeToken()
+}
+
+func (s *ChangeStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.cs.Err()
+}
+
+// Close stops the stream and releases its server cursor, it is safe to call
+// more than once
+func (s *ChangeStream) Close() error {
+	var err error
+
+	s.close.Do(func() {
+		defer s.ops.leave()
+
+		s.cancel()
+
+		err = s.cs.Close(s.parent)
+	})
+
+	return err
+}
+
+// Watch opens a change stream on coll, pipeline may filter or reshape the
+// events and can be nil. The stream fails when the connection of db is
+// replaced, reopen it with WatchOptions.ResumeAfter to continue. Shutdown
+// stops it and waits until it is closed
+func (db *DB) Watch(coll string, pipeline interface{}) (*ChangeStream, error) {
+	return db.WatchWithOptions(coll, pipeline, nil)
+}
+
+func (db *DB) WatchWithOptions(coll string, query interface{},
+	opts *WatchOptions) (*ChangeStream, error) {
+	var pipeline, err = stages(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", coll, err)
+	}
+
+	if db.mongoClient() == nil {
+		return nil, ErrNotConnected
+	}
+
+	if !db.ops.enter() {
+		return nil, ErrShutdown
+	}
+
+	var (
+		cs *mongo.ChangeStream
+		o  = &Op{Name: "watch", Collection: coll, Query: pipeline}
+	)
+
+	err = db.read(o, func(ctx context.Context, c *mongo.Collection) error {
+		var err error
+
+		cs, err = c.Watch(ctx, pipeline, opts.changeStream())
+
+		return err
+	})
+	if err != nil {
+		db.ops.leave()
+		return nil, err
+	}
+
+	// the stream outlives the operation that opened it, it ends with the
+	// context of db
+	var ctx, cancel = context.WithCancel(db.parent())
+
+	// the stream runs until closed, Shutdown ends it instead of waiting
+	go func() {
+		select {
+		case <-db.ops.stopping():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return &ChangeStream{cs: cs, ctx: ctx, cancel: cancel, parent: db.parent(), ops: db.ops}, nil
+}